@@ -0,0 +1,69 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var controllerCmd = &cobra.Command{
+	Use:   "controller",
+	Run:   runControllerCmd,
+	Short: "Reconcile VaultSecret custom resources into Kubernetes secrets.",
+	Long: `# vault-handler controller
+
+Watches "VaultSecret" custom resources, and reconciles each of them into a Kubernetes secret on the
+resource namespace, using the same logic than "copy". The resource spec follows the manifest schema
+of a secrets group, and the secret is named after the resource. Resources are reconciled again on
+every "--interval", and status carries a "Synced" condition, last secret version read and error.
+
+Use "--namespace" to watch a single namespace, by default all namespaces are watched.
+`,
+}
+
+// runControllerCmd reconcile custom resources, until receiving SIGINT or SIGTERM.
+func runControllerCmd(cmd *cobra.Command, args []string) {
+	logger := log.WithField("cmd", "controller")
+	logger.Info("Starting controller")
+
+	h := bootstrap()
+	if err := config.ValidateController(); err != nil {
+		log.Fatalf("[ERROR] On validating parameters: '%s'", err)
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		logger.Infof("Received signal '%s'", <-signals)
+		close(stop)
+	}()
+
+	if err := h.RunController(stop); err != nil {
+		logger.Fatalf("On running controller: '%s'", err)
+		os.Exit(1)
+	}
+
+	teardown(h)
+}
+
+func init() {
+	flags := controllerCmd.PersistentFlags()
+
+	flags.String("namespace", "", "Kubernetes namespace to watch, all namespaces when empty")
+	flags.Duration("interval", 5*time.Minute, "Interval between reconciliations of a resource")
+	flags.String("context", "", "Kubernetes context")
+	flags.String("kube-config", "", "Kubernetes '~/.kube/config' alternative path")
+	flags.Bool("in-cluster", false, "Peek is running inside Kubernetes")
+
+	rootCmd.AddCommand(controllerCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
@@ -20,6 +20,13 @@ Kubernetes it will be updated, if different than in Vault.
 
 The manifest file defines which type of secret will be created in Kubernetes, and based in the Secret
 type, certain keys will be mandatory, so be aware about setting up mandatory items.
+
+With "--prune", secrets created by "copy" for the same manifest file, which are no longer present in
+the manifest, are deleted. Secrets without "vault-handler" ownership labels are never touched. Only
+namespaces targeted by the manifest are searched, unless "--prune-all-namespaces" is informed, which
+requires permission to list secrets and config-maps cluster-wide.
+
+With "--inspect-certs", PEM certificates are inspected before copying, the same way than "download".
 `,
 }
 
@@ -38,15 +45,22 @@ func runCopyCmd(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 	})
+
+	teardown(h)
 }
 
 func init() {
 	flags := copyCmd.PersistentFlags()
 
 	flags.String("context", "", "Kubernetes context")
-	flags.String("namespace", "", "Kubernetes namespace")
+	flags.String("namespace", "", "Kubernetes namespace, when not informed in manifest group")
 	flags.String("kube-config", "", "Kubernetes '~/.kube/config' alternative path")
 	flags.Bool("in-cluster", false, "Peek is running inside Kubernetes")
+	flags.Bool("prune", false, "Delete secrets owned by manifest, no longer present in it")
+	flags.Bool("prune-all-namespaces", false, "Prune looking for owned secrets on all namespaces")
+	flags.Bool("inspect-certs", false, "Inspect certificates and keys before writing")
+	flags.Duration("cert-min-validity", 0, "Minimum remaining validity of certificates inspected")
+	flags.Bool("cert-warn-only", false, "Only warn about certificate problems, instead of failing")
 
 	rootCmd.AddCommand(copyCmd)
 
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	vh "github.com/otaviof/vault-handler/pkg/vault-handler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff [manifest-files]",
+	Run:   runDiffCmd,
+	Short: `Compare secrets in manifest between files, Vault and Kubernetes`,
+	Long: `# vault-handler diff
+
+Compare secrets described in manifest, without writing. Using "--target vault", the default, files
+in input directory are compared with Vault, while "--target kubernetes" compares Vault with
+Kubernetes secrets.
+
+Changes are printed one per line, showing only key names and a short SHA-256 of the contents,
+values are never shown:
+
+    + group/key (sha256:...)                 key is not present on target
+    - group/key (sha256:...)                 key is only present on target
+    ~ group/key (sha256:... -> sha256:...)   key contents are different
+
+Exits with status code 2 when changes are found, and zero otherwise.
+`,
+}
+
+func runDiffCmd(cmd *cobra.Command, args []string) {
+	var drift bool
+
+	logger := log.WithField("cmd", "diff")
+	logger.Info("Starting diff")
+
+	h := bootstrap()
+	if config.DiffTarget == vh.KubernetesDiffTarget {
+		if err := config.ValidateKubernetes(); err != nil {
+			log.Fatalf("[ERROR] On validating parameters: '%s'", err)
+		}
+	}
+
+	loopManifests(logger, args, func(logger *log.Entry, m *vh.Manifest) {
+		changes, err := h.Diff(m)
+		if err != nil {
+			logger.Fatalf("On realization of manifest: '%s'", err)
+			os.Exit(1)
+		}
+		for _, change := range changes {
+			fmt.Println(change)
+		}
+		if len(changes) > 0 {
+			drift = true
+		}
+	})
+
+	teardown(h)
+	if drift {
+		logger.Warn("Differences found!")
+		os.Exit(2)
+	}
+}
+
+func init() {
+	flags := diffCmd.PersistentFlags()
+
+	flags.String("target", vh.VaultDiffTarget, "Compare with 'vault' or 'kubernetes'")
+	flags.String("input-dir", ".", "Input directory, when target is Vault")
+	flags.String("strategy", "", "Upload strategy, 'replace' reports keys only found in Vault")
+	flags.String("context", "", "Kubernetes context")
+	flags.String("namespace", "", "Kubernetes namespace")
+	flags.String("kube-config", "", "Kubernetes '~/.kube/config' alternative path")
+	flags.Bool("in-cluster", false, "Peek is running inside Kubernetes")
+
+	rootCmd.AddCommand(diffCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
@@ -17,7 +17,12 @@ var downloadCmd = &cobra.Command{
 	Long: ` # vault-handler download
 
 Based on informed manifest, it download the secrets from Vault and rename the files accordingly. The
-output location is informed by "--output-dir" parameter.
+output location is informed by "--output-dir" parameter. Templates listed in the manifest are
+rendered with downloaded secrets, and written on the same directory.
+
+With "--inspect-certs", PEM certificates are inspected before writing: chain order, matching private
+key in the same group, and expiry against "--cert-min-validity". Problems fail the download, unless
+"--cert-warn-only" is informed.
 `,
 }
 
@@ -34,6 +39,8 @@ func runDownloadCmd(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 	})
+
+	teardown(h)
 }
 
 func init() {
@@ -41,6 +48,9 @@ func init() {
 
 	flags.String("output-dir", ".", "Output directory.")
 	flags.Bool("dot-env", false, "Create a dot-env file with downloaded secrets")
+	flags.Bool("inspect-certs", false, "Inspect certificates and keys before writing")
+	flags.Duration("cert-min-validity", 0, "Minimum remaining validity of certificates inspected")
+	flags.Bool("cert-warn-only", false, "Only warn about certificate problems, instead of failing")
 
 	rootCmd.AddCommand(downloadCmd)
 
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	vh "github.com/otaviof/vault-handler/pkg/vault-handler"
+)
+
+var execCmd = &cobra.Command{
+	Use:   "exec [manifest-files] -- command [arguments]",
+	Run:   runExecCmd,
+	Short: "Run a command with secrets from Vault in its environment.",
+	Long: `# vault-handler exec
+
+Based on informed manifests, it downloads secrets from Vault and runs the command informed after
+"--", with secrets as environment variables. Secrets are not written to the file-system. Variable
+names follow the same convention than "--dot-env", "GROUP_NAME_EXTENSION", with optional "--prefix".
+
+Signals received are forwarded to the command, and "vault-handler" exits with the command's exit
+code. With "--restart", secrets are downloaded again on every "--interval", plus a random "--jitter",
+and the command is restarted when they change.
+
+Logs are written to standard error, keeping standard output to the command.
+`,
+}
+
+// runExecCmd run command with secrets in environment.
+func runExecCmd(cmd *cobra.Command, args []string) {
+	var manifests []*vh.Manifest
+
+	log.SetOutput(os.Stderr)
+	logger := log.WithField("cmd", "exec")
+	logger.Info("Starting exec")
+
+	dash := cmd.ArgsLenAtDash()
+	if dash < 0 || dash == len(args) {
+		log.Fatalf("[ERROR] Command is not informed, use '--' before command")
+	}
+
+	h := bootstrap()
+	if config.ExecRestart {
+		if err := config.ValidateWatch(); err != nil {
+			log.Fatalf("[ERROR] On validating parameters: '%s'", err)
+		}
+	}
+
+	loopManifests(logger, args[:dash], func(logger *log.Entry, m *vh.Manifest) {
+		manifests = append(manifests, m)
+	})
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGQUIT,
+		syscall.SIGUSR1, syscall.SIGUSR2)
+
+	code, err := h.Exec(manifests, args[dash:], signals)
+	if err != nil {
+		logger.Fatalf("On executing command: '%s'", err)
+		os.Exit(1)
+	}
+
+	teardown(h)
+	os.Exit(code)
+}
+
+func init() {
+	flags := execCmd.PersistentFlags()
+
+	flags.String("prefix", "", "Environment variable name prefix")
+	flags.Bool("restart", false, "Restart command when secrets change")
+	flags.Duration("interval", time.Minute, "Interval between downloads, on restart")
+	flags.Duration("jitter", 10*time.Second, "Maximum random delay added to interval")
+
+	rootCmd.AddCommand(execCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	vh "github.com/otaviof/vault-handler/pkg/vault-handler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var lintCmd = &cobra.Command{
+	Use:   "lint [manifest-files]",
+	Run:   runLintCmd,
+	Short: "Validate manifest files, without contacting Vault or Kubernetes.",
+	Long: `# vault-handler lint
+
+Validate manifest files against the manifest schema, rejecting unknown fields, and checking required
+fields, duplicated names in a group, and colliding file names. With "--kubernetes", Kubernetes naming
+rules of secret names, keys, namespaces, labels, annotations and workloads are checked as well.
+
+Problems are printed one per line, as "file:line:column: field: message". Exits with status code 1
+when problems are found.
+`,
+}
+
+// runLintCmd validate manifest files, printing all problems found.
+func runLintCmd(cmd *cobra.Command, args []string) {
+	var failed bool
+
+	log.SetOutput(os.Stderr)
+	loadConfig()
+	logger := log.WithField("cmd", "lint")
+
+	for _, manifestFile := range args {
+		logger.WithField("manifest", manifestFile).Info("Linting manifest")
+
+		err := lintManifest(manifestFile, viper.GetBool("kubernetes"))
+		if err == nil {
+			continue
+		}
+		failed = true
+		if errs, ok := err.(vh.ManifestErrors); ok {
+			for _, manifestErr := range errs {
+				fmt.Println(manifestErr)
+			}
+		} else {
+			fmt.Printf("%s: %s\n", manifestFile, err)
+		}
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lintManifest parse and validate a single manifest file.
+func lintManifest(manifestFile string, kubernetes bool) error {
+	var payload []byte
+	var m *vh.Manifest
+	var err error
+
+	if payload, err = ioutil.ReadFile(manifestFile); err != nil {
+		return err
+	}
+	if m, err = vh.ParseManifest(manifestFile, payload); err != nil {
+		return err
+	}
+	if kubernetes {
+		return m.ValidateKubernetes()
+	}
+	return m.Validate()
+}
+
+func init() {
+	flags := lintCmd.PersistentFlags()
+
+	flags.Bool("kubernetes", false, "Check Kubernetes naming rules as well")
+
+	rootCmd.AddCommand(lintCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+
+	vh "github.com/otaviof/vault-handler/pkg/vault-handler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var renderCmd = &cobra.Command{
+	Use:   "render [manifest-files]",
+	Run:   runRenderCmd,
+	Short: `Render Kubernetes secrets from Vault as YAML, without calling Kubernetes`,
+	Long: `# vault-handler render
+
+Download secrets from Vault and render Kubernetes objects, in the same way than "copy" would write
+them, one "v1/Secret" document per manifest group and namespace, using the manifest "type". Groups
+with "kind: ConfigMap" are rendered as "v1/ConfigMap". A kube-config is not needed.
+
+Documents are printed on standard output, or written on "--output-dir" as "group.yaml", or
+"namespace.group.yaml" when a namespace is informed. Logs are written to standard error.
+
+Rendered documents carry secret data, handle them as secrets.
+`,
+}
+
+// runRenderCmd render Kubernetes objects for secrets in manifests.
+func runRenderCmd(cmd *cobra.Command, args []string) {
+	log.SetOutput(os.Stderr)
+	logger := log.WithField("cmd", "render")
+	logger.Info("Starting render")
+
+	h := bootstrap()
+
+	loopManifests(logger, args, func(logger *log.Entry, m *vh.Manifest) {
+		if err := h.Render(m, os.Stdout); err != nil {
+			logger.Fatalf("On realization of manifest: '%s'", err)
+			os.Exit(1)
+		}
+	})
+
+	teardown(h)
+}
+
+func init() {
+	flags := renderCmd.PersistentFlags()
+
+	flags.String("format", vh.K8sYAMLFormat, "Output format, only 'k8s-yaml' is supported")
+	flags.String("output-dir", "", "Output directory, standard output when empty")
+	flags.String("namespace", "", "Kubernetes namespace, when not informed in manifest group")
+
+	rootCmd.AddCommand(renderCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
@@ -17,6 +17,19 @@ var uploadCmd = &cobra.Command{
 
 Based on manifest, it will look for files in "--input-dir" based in naming convention, and upload
 data to Vault accordingly, following configuration for Vault's path and zipped contents.
+
+Using "--cas", the current version of each Vault path is read before uploading, and the upload
+only succeeds when the path is still on the same version, therefore concurrent uploads of the same
+manifest don't silently overwrite each other. Check-and-set requires key-value version 2.
+
+Upload strategy, informed by "--strategy" or "strategy" in manifest groups, defines what happens
+with keys stored on a Vault path that are not part of the manifest:
+
+  - replace: the whole secret is replaced by manifest keys, other keys are dropped;
+  - merge: existing data is read, and manifest keys are overlaid, other keys are kept;
+  - patch: manifest keys are patched on the secret, other keys are kept (key-value version 2);
+
+On dry-run, keys that would be kept or dropped are displayed.
 `,
 }
 
@@ -43,12 +56,16 @@ func runUploadCmd(cmd *cobra.Command, args []string) {
 			os.Exit(1)
 		}
 	}
+
+	teardown(handler)
 }
 
 func init() {
 	flags := uploadCmd.PersistentFlags()
 
 	flags.String("input-dir", ".", "Input directory.")
+	flags.String("strategy", "replace", "Upload strategy (replace, merge or patch)")
+	flags.Bool("cas", false, "Check-and-set uploads, fails when secret is changed in between (kv-v2)")
 
 	rootCmd.AddCommand(uploadCmd)
 
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"os"
 	"strings"
 
@@ -53,6 +54,7 @@ And later call "vault-handler" with additional arguments, and the manifest files
 
 ## Command-Line
 `,
+	PersistentPreRun: bindFlags,
 }
 
 var config *vh.Config // global configuration instance
@@ -64,33 +66,75 @@ type actOnManifest func(logger *log.Entry, m *vh.Manifest)
 // environment variables.
 func configFromEnv() *vh.Config {
 	return &vh.Config{
-		DryRun:        viper.GetBool("dry-run"),
-		OutputDir:     viper.GetString("output-dir"),
-		DotEnv:        viper.GetBool("dot-env"),
-		InputDir:      viper.GetString("input-dir"),
-		VaultAddr:     viper.GetString("vault-addr"),
-		VaultToken:    viper.GetString("vault-token"),
-		VaultRoleID:   viper.GetString("vault-role-id"),
-		VaultSecretID: viper.GetString("vault-secret-id"),
-		InCluster:     viper.GetBool("in-cluster"),
-		Context:       viper.GetString("context"),
-		Namespace:     viper.GetString("namespace"),
-		KubeConfig:    viper.GetString("kube-config"),
+		DryRun:           viper.GetBool("dry-run"),
+		OutputDir:        viper.GetString("output-dir"),
+		DotEnv:           viper.GetBool("dot-env"),
+		WatchInterval:    viper.GetDuration("interval"),
+		WatchJitter:      viper.GetDuration("jitter"),
+		ReloadPID:        viper.GetInt("reload-pid"),
+		ReloadSignal:     viper.GetString("reload-signal"),
+		ReloadURL:        viper.GetString("reload-url"),
+		ExecPrefix:       viper.GetString("prefix"),
+		ExecRestart:      viper.GetBool("restart"),
+		InputDir:         viper.GetString("input-dir"),
+		CAS:              viper.GetBool("cas"),
+		Strategy:         viper.GetString("strategy"),
+		DiffTarget:       viper.GetString("target"),
+		RenderFormat:     viper.GetString("format"),
+		VaultAddr:        viper.GetString("vault-addr"),
+		VaultAuthMethod:  viper.GetString("vault-auth-method"),
+		VaultAuthOptions: authOptionsFromEnv(),
+		VaultKeepToken:   viper.GetBool("vault-keep-token"),
+		Prune:            viper.GetBool("prune"),
+		PruneAll:         viper.GetBool("prune-all-namespaces"),
+		CertInspect:      viper.GetBool("inspect-certs"),
+		CertMinValidity:  viper.GetDuration("cert-min-validity"),
+		CertWarnOnly:     viper.GetBool("cert-warn-only"),
+		WebhookListen:    viper.GetString("listen"),
+		WebhookTLSCert:   viper.GetString("tls-cert"),
+		WebhookTLSKey:    viper.GetString("tls-key"),
+		WebhookImage:     viper.GetString("image"),
+		WebhookMountPath: viper.GetString("mount-path"),
+		InCluster:        viper.GetBool("in-cluster"),
+		Context:          viper.GetString("context"),
+		Namespace:        viper.GetString("namespace"),
+		KubeConfig:       viper.GetString("kube-config"),
 	}
 }
 
-// bootstrap creates connection with vault, by instantiating Handler.
-func bootstrap() *vh.Handler {
-	var level log.Level
-	var handler *vh.Handler
-	var err error
+// bindFlags binds flags of the command being executed, since sub-commands share flag names.
+func bindFlags(cmd *cobra.Command, args []string) {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		log.Fatal(err)
+	}
+}
 
-	if level, err = log.ParseLevel(viper.GetString("log-level")); err != nil {
+// authOptionsFromEnv collect the options declared by all authentication methods.
+func authOptionsFromEnv() vh.AuthOptions {
+	opts := vh.AuthOptions{}
+	for _, option := range vh.AuthOptionsFlags() {
+		opts[option.Name] = viper.GetString(option.Name)
+	}
+	return opts
+}
+
+// loadConfig set log level and load global configuration instance.
+func loadConfig() {
+	level, err := log.ParseLevel(viper.GetString("log-level"))
+	if err != nil {
 		log.Fatalf("[ERROR] On parsing log-level: '%s'", err)
 	}
 	log.SetLevel(level)
 
 	config = configFromEnv()
+}
+
+// bootstrap creates connection with vault, by instantiating Handler.
+func bootstrap() *vh.Handler {
+	var handler *vh.Handler
+	var err error
+
+	loadConfig()
 
 	if err = config.Validate(); err != nil {
 		log.Fatalf("[ERROR] On validating parameters: '%s'", err)
@@ -101,10 +145,19 @@ func bootstrap() *vh.Handler {
 	if err = handler.Authenticate(); err != nil {
 		log.Fatalf("[ERROR] On authenticating against Vault: '%s'", err)
 	}
+	// making sure token is revoked when exiting on errors
+	log.RegisterExitHandler(func() { teardown(handler) })
 
 	return handler
 }
 
+// teardown stop token renewal and revoke obtained token, before exiting.
+func teardown(handler *vh.Handler) {
+	if err := handler.Close(); err != nil {
+		log.Errorf("[ERROR] On closing Vault session: '%s'", err)
+	}
+}
+
 // loopManifests loop args and transform them in manifest instances, yielding informed func.
 func loopManifests(logger *log.Entry, args []string, fn actOnManifest) error {
 	var m *vh.Manifest
@@ -140,9 +193,12 @@ func init() {
 
 	// command-line flags
 	flags.String("vault-addr", "http://127.0.0.1:8200", "Vault address")
-	flags.String("vault-token", "", "Vault access token")
-	flags.String("vault-role-id", "", "Vault AppRole role-id")
-	flags.String("vault-secret-id", "", "Vault AppRole secret-id")
+	flags.String("vault-auth-method", "", fmt.Sprintf(
+		"Vault authentication method (%s)", strings.Join(vh.AuthMethodNames(), ", ")))
+	for _, option := range vh.AuthOptionsFlags() {
+		flags.String(option.Name, option.Default, option.Usage)
+	}
+	flags.Bool("vault-keep-token", false, "Do not revoke token obtained via login on exit")
 	flags.Bool("dry-run", false, "dry-run mode")
 	flags.String("log-level", "debug", "dry-run mode")
 
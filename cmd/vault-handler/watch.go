@@ -0,0 +1,78 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	vh "github.com/otaviof/vault-handler/pkg/vault-handler"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch [manifest-files]",
+	Run:   runWatchCmd,
+	Short: "Download secrets from Vault continuously, rewriting files when they change.",
+	Long: `# vault-handler watch
+
+Based on informed manifests, it downloads secrets from Vault on every "--interval", plus a random
+"--jitter", like "download" does. Only files that have changed are rewritten, atomically, in
+"--output-dir". Suitable to run as a sidecar container, it stops on SIGINT or SIGTERM.
+
+After files are changed, the application consuming the secrets can be notified by sending a signal
+to "--reload-pid", and/or by posting to "--reload-url".
+`,
+}
+
+// runWatchCmd execute the download of secrets from Vault, continuously.
+func runWatchCmd(cmd *cobra.Command, args []string) {
+	var manifests []*vh.Manifest
+
+	logger := log.WithField("cmd", "watch")
+	logger.Info("Starting watch")
+
+	h := bootstrap()
+	if err := config.ValidateWatch(); err != nil {
+		log.Fatalf("[ERROR] On validating parameters: '%s'", err)
+	}
+
+	loopManifests(logger, args, func(logger *log.Entry, m *vh.Manifest) {
+		manifests = append(manifests, m)
+	})
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		logger.Infof("Received signal '%s'", <-signals)
+		close(stop)
+	}()
+
+	if err := h.Watch(manifests, stop); err != nil {
+		logger.Fatalf("On watching manifests: '%s'", err)
+		os.Exit(1)
+	}
+
+	teardown(h)
+}
+
+func init() {
+	flags := watchCmd.PersistentFlags()
+
+	flags.String("output-dir", ".", "Output directory.")
+	flags.Duration("interval", time.Minute, "Interval between downloads")
+	flags.Duration("jitter", 10*time.Second, "Maximum random delay added to interval")
+	flags.Int("reload-pid", 0, "Process id to signal after secrets changed")
+	flags.String("reload-signal", "HUP", "Signal sent to reload process")
+	flags.String("reload-url", "", "URL to post after secrets changed")
+
+	rootCmd.AddCommand(watchCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
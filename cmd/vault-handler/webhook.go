@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	vh "github.com/otaviof/vault-handler/pkg/vault-handler"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var webhookCmd = &cobra.Command{
+	Use:   "webhook",
+	Run:   runWebhookCmd,
+	Short: "Serve a mutating admission webhook injecting vault-handler init-container.",
+	Long: `# vault-handler webhook
+
+Serves a Kubernetes MutatingAdmissionWebhook over TLS, on "/mutate". Pods annotated with a manifest
+receive a "vault-handler" init-container running "download", an in-memory "emptyDir" volume for
+secrets, mounted read-only on "--mount-path" in every container, and a volume with the manifest.
+
+The manifest is informed by one of the pod annotations:
+
+    vault-handler/inject-manifest: inline manifest YAML
+    vault-handler/inject-configmap: config-map name, on pod namespace, with "manifest.yaml" key
+
+With "vault-handler/inject-role", the init-container authenticates using Kubernetes method and the
+informed role. The webhook itself does not use Vault credentials, "--vault-addr" is only handed over
+to the init-container.
+`,
+}
+
+// runWebhookCmd serve admission webhook, until receiving SIGINT or SIGTERM.
+func runWebhookCmd(cmd *cobra.Command, args []string) {
+	logger := log.WithField("cmd", "webhook")
+	logger.Info("Starting webhook")
+
+	loadConfig()
+	if err := config.ValidateWebhook(); err != nil {
+		log.Fatalf("[ERROR] On validating parameters: '%s'", err)
+	}
+
+	stop := make(chan struct{})
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		logger.Infof("Received signal '%s'", <-signals)
+		close(stop)
+	}()
+
+	injector := vh.NewInjector(config.WebhookImage, config.VaultAddr, config.WebhookMountPath)
+	webhook := vh.NewWebhook(injector, config.WebhookListen, config.WebhookTLSCert, config.WebhookTLSKey)
+	if err := webhook.Run(stop); err != nil {
+		logger.Fatalf("On serving webhook: '%s'", err)
+	}
+}
+
+func init() {
+	flags := webhookCmd.PersistentFlags()
+
+	flags.String("listen", ":8443", "Listen address")
+	flags.String("tls-cert", "", "TLS certificate file")
+	flags.String("tls-key", "", "TLS key file")
+	flags.String("image", "otaviof/vault-handler:latest", "Image employed on init-container")
+	flags.String("mount-path", "/vault-handler/secrets", "Path secrets are mounted on containers")
+
+	rootCmd.AddCommand(webhookCmd)
+
+	if err := viper.BindPFlags(flags); err != nil {
+		log.Panic(err)
+	}
+}
@@ -0,0 +1,419 @@
+package vaulthandler
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+const (
+	// TokenAuthMethod authenticate using a token directly.
+	TokenAuthMethod = "token"
+	// AppRoleAuthMethod authenticate using AppRole role-id and secret-id.
+	AppRoleAuthMethod = "approle"
+	// KubernetesAuthMethod authenticate using Kubernetes service-account token.
+	KubernetesAuthMethod = "kubernetes"
+	// JWTAuthMethod authenticate using a JWT/OIDC token.
+	JWTAuthMethod = "jwt"
+	// CertAuthMethod authenticate using a TLS client certificate.
+	CertAuthMethod = "cert"
+	// UserPassAuthMethod authenticate using username and password.
+	UserPassAuthMethod = "userpass"
+	// LDAPAuthMethod authenticate using LDAP username and password.
+	LDAPAuthMethod = "ldap"
+)
+
+// vaultAgentSinkFile default location of token written by Vault Agent sidecar.
+const vaultAgentSinkFile = "/vault/secrets/token"
+
+// AuthMethod represents a Vault authentication method, which declares its own configuration options,
+// how to validate them and how to login.
+type AuthMethod interface {
+	Name() string                               // method name, as in "--vault-auth-method"
+	Options() []AuthOption                      // configuration options used by the method
+	Validate(opts AuthOptions) error            // method specific validation, after required options
+	Login(vault *Vault, opts AuthOptions) error // authenticate against vault
+}
+
+// AuthOption describes a single authentication option, also employed as command-line flag.
+type AuthOption struct {
+	Name     string // option name, also the command-line flag name
+	Default  string // default value
+	Usage    string // command-line flag usage
+	Required bool   // option must be informed
+	File     bool   // option can be read from a file, informed via "<name>-file"
+}
+
+// fileOptionName name of the option carrying the file path for a given option.
+func fileOptionName(name string) string {
+	return fmt.Sprintf("%s-file", name)
+}
+
+// expandOptions returns method options followed by file path options, when supported.
+func expandOptions(method AuthMethod) []AuthOption {
+	var options []AuthOption
+	for _, option := range method.Options() {
+		options = append(options, option)
+		if option.File {
+			options = append(options, AuthOption{
+				Name:  fileOptionName(option.Name),
+				Usage: fmt.Sprintf("%s, read from file", option.Usage),
+			})
+		}
+	}
+	return options
+}
+
+// AuthOptions authentication option values, option name as key.
+type AuthOptions map[string]string
+
+// authMethods registry of authentication methods, method name as key.
+var authMethods = make(map[string]AuthMethod)
+
+// RegisterAuthMethod add a authentication method to registry, overwriting methods with same name.
+func RegisterAuthMethod(method AuthMethod) {
+	authMethods[method.Name()] = method
+}
+
+// GetAuthMethod returns a registered authentication method by name.
+func GetAuthMethod(name string) (AuthMethod, error) {
+	method, found := authMethods[name]
+	if !found {
+		return nil, fmt.Errorf("unknown vault-auth-method '%s'", name)
+	}
+	return method, nil
+}
+
+// AuthMethods returns all registered authentication methods, sorted by name.
+func AuthMethods() []AuthMethod {
+	var methods []AuthMethod
+	for _, method := range authMethods {
+		methods = append(methods, method)
+	}
+	sort.Slice(methods, func(i, j int) bool { return methods[i].Name() < methods[j].Name() })
+	return methods
+}
+
+// AuthMethodNames returns the names of registered authentication methods.
+func AuthMethodNames() []string {
+	var names []string
+	for _, method := range AuthMethods() {
+		names = append(names, method.Name())
+	}
+	return names
+}
+
+// AuthOptionsFlags returns all options declared by registered methods, without repetition.
+func AuthOptionsFlags() []AuthOption {
+	var options []AuthOption
+	seen := make(map[string]bool)
+	for _, method := range AuthMethods() {
+		for _, option := range expandOptions(method) {
+			if seen[option.Name] {
+				continue
+			}
+			seen[option.Name] = true
+			options = append(options, option)
+		}
+	}
+	return options
+}
+
+// inferAuthMethod find the only authentication method having all required options informed.
+func inferAuthMethod(opts AuthOptions) (AuthMethod, error) {
+	var candidates []AuthMethod
+	var names []string
+
+	for _, method := range AuthMethods() {
+		if missingRequired(method, opts) == "" {
+			candidates = append(candidates, method)
+			names = append(names, method.Name())
+		}
+	}
+
+	switch len(candidates) {
+	case 0:
+		return nil, fmt.Errorf("inform vault-auth-method, or credentials like vault-token, or " +
+			"vault-role-id and secret-id")
+	case 1:
+		return candidates[0], nil
+	default:
+		return nil, fmt.Errorf("credentials informed match more than one authentication method "+
+			"(%s), inform vault-auth-method", strings.Join(names, ", "))
+	}
+}
+
+// validateAuthOptions check required options are present, and options from other methods are not.
+func validateAuthOptions(method AuthMethod, opts AuthOptions) error {
+	if name := missingRequired(method, opts); name != "" {
+		return fmt.Errorf("%s is not informed, required by vault-auth-method '%s'", name, method.Name())
+	}
+
+	owned := make(map[string]bool)
+	for _, option := range expandOptions(method) {
+		owned[option.Name] = true
+	}
+	for _, option := range AuthOptionsFlags() {
+		value := opts[option.Name]
+		if owned[option.Name] || value == "" || value == option.Default {
+			continue
+		}
+		return fmt.Errorf("%s can't be used in combination with vault-auth-method '%s'",
+			option.Name, method.Name())
+	}
+
+	return method.Validate(withDefaults(method, opts))
+}
+
+// missingRequired returns the first required option not informed, or empty.
+func missingRequired(method AuthMethod, opts AuthOptions) string {
+	for _, option := range method.Options() {
+		if option.Required && opts[option.Name] == "" {
+			return option.Name
+		}
+	}
+	return ""
+}
+
+// withDefaults returns a copy of informed options, where empty values are replaced by defaults.
+func withDefaults(method AuthMethod, opts AuthOptions) AuthOptions {
+	merged := make(AuthOptions)
+	for k, v := range opts {
+		merged[k] = v
+	}
+	for _, option := range method.Options() {
+		if merged[option.Name] == "" {
+			merged[option.Name] = option.Default
+		}
+	}
+	return merged
+}
+
+// tokenAuth uses a informed token directly.
+type tokenAuth struct{}
+
+func (a *tokenAuth) Name() string { return TokenAuthMethod }
+
+func (a *tokenAuth) Options() []AuthOption {
+	return []AuthOption{{Name: "vault-token", Usage: "Vault access token", Required: true, File: true}}
+}
+
+func (a *tokenAuth) Validate(opts AuthOptions) error { return nil }
+
+func (a *tokenAuth) Login(vault *Vault, opts AuthOptions) error {
+	vault.TokenAuth(opts["vault-token"])
+	return nil
+}
+
+// appRoleAuth exchange role-id and secret-id by a token.
+type appRoleAuth struct{}
+
+func (a *appRoleAuth) Name() string { return AppRoleAuthMethod }
+
+func (a *appRoleAuth) Options() []AuthOption {
+	return []AuthOption{
+		{Name: "vault-role-id", Usage: "Vault AppRole role-id", Required: true, File: true},
+		{Name: "vault-secret-id", Usage: "Vault AppRole secret-id", File: true},
+		{
+			Name:  "vault-secret-id-wrapped",
+			Usage: "Vault AppRole secret-id, as response-wrapping token",
+			File:  true,
+		},
+		{Name: "vault-role-name", Usage: "Vault AppRole role name, to validate wrapped secret-id"},
+	}
+}
+
+func (a *appRoleAuth) Validate(opts AuthOptions) error {
+	if (opts["vault-secret-id"] == "") == (opts["vault-secret-id-wrapped"] == "") {
+		return fmt.Errorf("inform either vault-secret-id or vault-secret-id-wrapped")
+	}
+	if opts["vault-secret-id-wrapped"] != "" && opts["vault-role-name"] == "" {
+		return fmt.Errorf("vault-role-name is required to validate wrapped secret-id")
+	}
+	return nil
+}
+
+func (a *appRoleAuth) Login(vault *Vault, opts AuthOptions) error {
+	var err error
+
+	secretID := opts["vault-secret-id"]
+	if wrappingToken := opts["vault-secret-id-wrapped"]; wrappingToken != "" {
+		if secretID, err = vault.UnwrapSecretID(wrappingToken, opts["vault-role-name"]); err != nil {
+			return err
+		}
+	}
+	return vault.AppRoleAuth(opts["vault-role-id"], secretID)
+}
+
+// kubernetesAuth exchange a service-account token by a Vault token.
+type kubernetesAuth struct{}
+
+func (a *kubernetesAuth) Name() string { return KubernetesAuthMethod }
+
+func (a *kubernetesAuth) Options() []AuthOption {
+	return []AuthOption{
+		{Name: "vault-k8s-role", Usage: "Vault Kubernetes authentication role", Required: true},
+		{
+			Name:    "vault-k8s-mount-path",
+			Default: "kubernetes",
+			Usage:   "Vault Kubernetes authentication mount path",
+		},
+		{
+			Name:    "vault-k8s-token-path",
+			Default: "/var/run/secrets/kubernetes.io/serviceaccount/token",
+			Usage:   "Kubernetes service-account token path",
+		},
+	}
+}
+
+func (a *kubernetesAuth) Validate(opts AuthOptions) error {
+	if !FileExists(opts["vault-k8s-token-path"]) {
+		return fmt.Errorf("can't find service-account token at '%s'", opts["vault-k8s-token-path"])
+	}
+	return nil
+}
+
+func (a *kubernetesAuth) Login(vault *Vault, opts AuthOptions) error {
+	return vault.KubernetesAuth(
+		opts["vault-k8s-mount-path"], opts["vault-k8s-role"], opts["vault-k8s-token-path"])
+}
+
+// jwtAuth exchange a JWT/OIDC token, read from file, by a Vault token.
+type jwtAuth struct{}
+
+func (a *jwtAuth) Name() string { return JWTAuthMethod }
+
+func (a *jwtAuth) Options() []AuthOption {
+	return []AuthOption{
+		{Name: "vault-jwt-role", Usage: "Vault JWT authentication role", Required: true},
+		{Name: "vault-jwt-path", Usage: "JWT token file path", Required: true},
+		{Name: "vault-jwt-mount-path", Default: "jwt", Usage: "Vault JWT authentication mount path"},
+	}
+}
+
+func (a *jwtAuth) Validate(opts AuthOptions) error {
+	if !FileExists(opts["vault-jwt-path"]) {
+		return fmt.Errorf("can't find JWT token at '%s'", opts["vault-jwt-path"])
+	}
+	return nil
+}
+
+func (a *jwtAuth) Login(vault *Vault, opts AuthOptions) error {
+	return vault.JWTAuth(opts["vault-jwt-mount-path"], opts["vault-jwt-role"], opts["vault-jwt-path"])
+}
+
+// certAuth uses a TLS client certificate to obtain a Vault token.
+type certAuth struct{}
+
+func (a *certAuth) Name() string { return CertAuthMethod }
+
+func (a *certAuth) Options() []AuthOption {
+	return []AuthOption{
+		{Name: "vault-client-cert", Usage: "TLS client certificate path", Required: true},
+		{Name: "vault-client-key", Usage: "TLS client key path", Required: true},
+		{Name: "vault-cert-role", Usage: "Vault certificate role name, optional"},
+		{Name: "vault-cert-mount-path", Default: "cert", Usage: "Vault certificate authentication mount path"},
+	}
+}
+
+func (a *certAuth) Validate(opts AuthOptions) error {
+	for _, name := range []string{"vault-client-cert", "vault-client-key"} {
+		if !FileExists(opts[name]) {
+			return fmt.Errorf("%s file is not found at '%s'", name, opts[name])
+		}
+	}
+	return nil
+}
+
+func (a *certAuth) Login(vault *Vault, opts AuthOptions) error {
+	return vault.CertAuth(opts["vault-cert-mount-path"], opts["vault-cert-role"],
+		opts["vault-client-cert"], opts["vault-client-key"])
+}
+
+// userPassAuth username and password based authentication, shared by "userpass" and "ldap" methods,
+// where only the mount path option differs.
+type userPassAuth struct {
+	name string // method name
+}
+
+func (a *userPassAuth) Name() string { return a.name }
+
+func (a *userPassAuth) Options() []AuthOption {
+	return []AuthOption{
+		{Name: "vault-username", Usage: "Vault username, for userpass and ldap", Required: true},
+		{
+			Name:     "vault-password",
+			Usage:    "Vault password, for userpass and ldap",
+			Required: true,
+			File:     true,
+		},
+		{
+			Name:    fmt.Sprintf("vault-%s-mount-path", a.name),
+			Default: a.name,
+			Usage:   fmt.Sprintf("Vault %s authentication mount path", a.name),
+		},
+	}
+}
+
+func (a *userPassAuth) Validate(opts AuthOptions) error { return nil }
+
+func (a *userPassAuth) Login(vault *Vault, opts AuthOptions) error {
+	mountPath := opts[fmt.Sprintf("vault-%s-mount-path", a.name)]
+	username := opts["vault-username"]
+	authData := map[string]interface{}{"password": opts["vault-password"]}
+
+	vault.logger.WithField("username", username).Infof("Starting %s authentication", a.name)
+	return vault.login(path.Join("auth", mountPath, "login", username), authData)
+}
+
+// resolveAuthFiles read option values from files informed via "<name>-file" options, in place. The
+// file option is removed once resolved, so resolving again is a no-op.
+func resolveAuthFiles(opts AuthOptions) error {
+	var value string
+	var err error
+
+	for _, option := range AuthOptionsFlags() {
+		file := opts[fileOptionName(option.Name)]
+		if !option.File || file == "" {
+			continue
+		}
+		if opts[option.Name] != "" {
+			return fmt.Errorf("%s can't be used in combination with %s",
+				option.Name, fileOptionName(option.Name))
+		}
+		if value, err = readCredentialFile(file); err != nil {
+			return err
+		}
+		opts[option.Name] = value
+		delete(opts, fileOptionName(option.Name))
+	}
+	return nil
+}
+
+// detectTokenFile look for a token written by Vault Agent, or by "vault login" on home directory,
+// returning the first found, or empty.
+func detectTokenFile() string {
+	candidates := []string{vaultAgentSinkFile}
+	if homeDir := os.Getenv("HOME"); homeDir != "" {
+		candidates = append(candidates, path.Join(homeDir, ".vault-token"))
+	}
+	for _, candidate := range candidates {
+		if FileExists(candidate) {
+			return candidate
+		}
+	}
+	return ""
+}
+
+// init registering built-in authentication methods.
+func init() {
+	RegisterAuthMethod(&tokenAuth{})
+	RegisterAuthMethod(&appRoleAuth{})
+	RegisterAuthMethod(&kubernetesAuth{})
+	RegisterAuthMethod(&jwtAuth{})
+	RegisterAuthMethod(&certAuth{})
+	RegisterAuthMethod(&userPassAuth{name: UserPassAuthMethod})
+	RegisterAuthMethod(&userPassAuth{name: LDAPAuthMethod})
+}
@@ -0,0 +1,98 @@
+package vaulthandler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthGetAuthMethod(t *testing.T) {
+	for _, name := range AuthMethodNames() {
+		method, err := GetAuthMethod(name)
+		assert.Nil(t, err)
+		assert.Equal(t, name, method.Name())
+	}
+
+	_, err := GetAuthMethod("unknown")
+	assert.NotNil(t, err)
+}
+
+func TestAuthInferAuthMethod(t *testing.T) {
+	method, err := inferAuthMethod(AuthOptions{"vault-token": "token"})
+	assert.Nil(t, err)
+	assert.Equal(t, TokenAuthMethod, method.Name())
+
+	method, err = inferAuthMethod(AuthOptions{"vault-role-id": "role", "vault-secret-id": "secret"})
+	assert.Nil(t, err)
+	assert.Equal(t, AppRoleAuthMethod, method.Name())
+
+	_, err = inferAuthMethod(AuthOptions{"vault-secret-id": "secret"})
+	assert.NotNil(t, err)
+
+	// username and password are shared by userpass and ldap
+	_, err = inferAuthMethod(AuthOptions{"vault-username": "user", "vault-password": "pass"})
+	assert.NotNil(t, err)
+}
+
+func TestAuthValidateAuthOptions(t *testing.T) {
+	method, _ := GetAuthMethod(TokenAuthMethod)
+
+	err := validateAuthOptions(method, AuthOptions{"vault-token": "token"})
+	assert.Nil(t, err)
+
+	err = validateAuthOptions(method, AuthOptions{"vault-token": "token", "vault-role-id": "role"})
+	assert.NotNil(t, err)
+
+	// default values from other methods are ignored
+	err = validateAuthOptions(method, AuthOptions{
+		"vault-token":          "token",
+		"vault-k8s-mount-path": "kubernetes",
+	})
+	assert.Nil(t, err)
+}
+
+func TestAuthValidateAppRoleOptions(t *testing.T) {
+	method, _ := GetAuthMethod(AppRoleAuthMethod)
+
+	err := validateAuthOptions(method, AuthOptions{"vault-role-id": "role"})
+	assert.NotNil(t, err)
+
+	err = validateAuthOptions(method, AuthOptions{
+		"vault-role-id":           "role",
+		"vault-secret-id":         "secret",
+		"vault-secret-id-wrapped": "wrapping-token",
+	})
+	assert.NotNil(t, err)
+
+	err = validateAuthOptions(method, AuthOptions{
+		"vault-role-id":           "role",
+		"vault-secret-id-wrapped": "wrapping-token",
+	})
+	assert.NotNil(t, err)
+
+	err = validateAuthOptions(method, AuthOptions{
+		"vault-role-id":           "role",
+		"vault-secret-id-wrapped": "wrapping-token",
+		"vault-role-name":         "name",
+	})
+	assert.Nil(t, err)
+}
+
+func TestAuthUserPassLogin(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/auth/ldap/login/user", r.URL.Path)
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "ldap-token"}}`))
+	}))
+	defer server.Close()
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	method, _ := GetAuthMethod(LDAPAuthMethod)
+	opts := withDefaults(method, AuthOptions{"vault-username": "user", "vault-password": "pass"})
+	err = method.Login(v, opts)
+	assert.Nil(t, err)
+	assert.Equal(t, "ldap-token", v.token)
+}
@@ -0,0 +1,167 @@
+package vaulthandler
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// CertificateReport outcome of inspecting a PEM certificate, or chain, found on a downloaded file.
+type CertificateReport struct {
+	Group     string        // manifest group name
+	Name      string        // secret name holding the certificate
+	Subject   string        // leaf certificate subject
+	NotAfter  time.Time     // earliest expiry in chain
+	Remaining time.Duration // validity left
+	Problems  []string      // problems found, chain order, key mismatch or expiry
+}
+
+// String representation of report, showing expiry.
+func (r *CertificateReport) String() string {
+	return fmt.Sprintf("%s/%s (%s) expires at %s, in %s", r.Group, r.Name, r.Subject,
+		r.NotAfter.UTC().Format(time.RFC3339), r.Remaining.Round(time.Minute))
+}
+
+// logCertificates log certificate reports expiry, as part of a run summary.
+func logCertificates(logger *log.Entry, reports []*CertificateReport) {
+	for _, report := range reports {
+		if len(report.Problems) > 0 {
+			logger.Warnf("Certificate '%s', problems: %s", report, strings.Join(report.Problems, "; "))
+			continue
+		}
+		logger.Infof("Certificate '%s'", report)
+	}
+}
+
+// Inspection of certificates and private keys in downloaded files. Certificates are checked for
+// chain order, expiry against a minimum remaining validity, and for matching the private key of the
+// same group.
+type Inspection struct {
+	logger      *log.Entry           // logger
+	minValidity time.Duration        // minimum remaining validity
+	warnOnly    bool                 // only warn about problems, instead of failing
+	now         func() time.Time     // current time
+	Reports     []*CertificateReport // certificates inspected
+}
+
+// Check files, grouped by manifest group, failing when problems are found, unless warn only.
+func (i *Inspection) Check(files []*File) error {
+	var problems []string
+
+	groups := make(map[string][]*File)
+	for _, file := range files {
+		groups[file.Group] = append(groups[file.Group], file)
+	}
+	for _, file := range files {
+		if !isPEMCertificate(file.Payload) {
+			continue
+		}
+		report := i.inspect(file, groups[file.Group])
+		i.Reports = append(i.Reports, report)
+
+		logger := i.logger.WithFields(log.Fields{"group": report.Group, "name": report.Name})
+		logger.Infof("Certificate '%s'", report)
+		for _, problem := range report.Problems {
+			logger.Warnf("Certificate problem: %s", problem)
+			problems = append(problems, fmt.Sprintf("%s/%s: %s", report.Group, report.Name, problem))
+		}
+	}
+
+	if len(problems) == 0 || i.warnOnly {
+		return nil
+	}
+	return fmt.Errorf("certificate inspection failed:\n%s", strings.Join(problems, "\n"))
+}
+
+// inspect certificate file, looking for the private key among group files.
+func (i *Inspection) inspect(file *File, group []*File) *CertificateReport {
+	report := &CertificateReport{Group: file.Group, Name: file.Properties.Name}
+
+	certs, err := parsePEMCertificates(file.Payload)
+	if err != nil {
+		report.Problems = append(report.Problems, fmt.Sprintf("unable to parse certificate: %s", err))
+		return report
+	}
+	report.Subject = certs[0].Subject.String()
+
+	for n, cert := range certs {
+		if report.NotAfter.IsZero() || cert.NotAfter.Before(report.NotAfter) {
+			report.NotAfter = cert.NotAfter
+		}
+		if n+1 < len(certs) {
+			if err = cert.CheckSignatureFrom(certs[n+1]); err != nil {
+				report.Problems = append(report.Problems, fmt.Sprintf("certificate %d is not signed "+
+					"by the next one, chain must be ordered from leaf to root: %s", n, err))
+			}
+		}
+	}
+
+	report.Remaining = report.NotAfter.Sub(i.now())
+	if report.Remaining <= 0 {
+		report.Problems = append(report.Problems, fmt.Sprintf("expired at %s",
+			report.NotAfter.UTC().Format(time.RFC3339)))
+	} else if report.Remaining < i.minValidity {
+		report.Problems = append(report.Problems, fmt.Sprintf("expires in %s, less than minimum of %s",
+			report.Remaining.Round(time.Minute), i.minValidity))
+	}
+
+	if key := privateKeyFile(file, group); key != nil {
+		if _, err = tls.X509KeyPair(file.Payload, key.Payload); err != nil {
+			report.Problems = append(report.Problems, fmt.Sprintf(
+				"does not match private key '%s': %s", key.Properties.Name, err))
+		}
+	}
+	return report
+}
+
+// privateKeyFile find the private key for certificate file by name, "tls.crt" pairs with "tls.key"
+// and "server.pem" with "server.key". Returns nil when not found, like for "ca.crt".
+func privateKeyFile(cert *File, group []*File) *File {
+	name := cert.Properties.Name
+	for _, suffix := range []string{"crt", "cert", "pem"} {
+		if strings.HasSuffix(name, suffix) {
+			name = strings.TrimSuffix(name, suffix) + "key"
+			break
+		}
+	}
+	if name == cert.Properties.Name {
+		return nil
+	}
+	for _, file := range group {
+		if file.Properties.Name != name {
+			continue
+		}
+		if validatePEMPrivateKey(file.Payload) != nil || isEncryptedPEMKey(file.Payload) {
+			return nil
+		}
+		return file
+	}
+	return nil
+}
+
+// isPEMCertificate checks if payload starts with a PEM certificate block.
+func isPEMCertificate(payload []byte) bool {
+	block, _ := pem.Decode(payload)
+	return block != nil && block.Type == "CERTIFICATE"
+}
+
+// isEncryptedPEMKey checks if payload is a encrypted PEM private key.
+func isEncryptedPEMKey(payload []byte) bool {
+	block, _ := pem.Decode(payload)
+	return block != nil && (block.Type == "ENCRYPTED PRIVATE KEY" || x509.IsEncryptedPEMBlock(block))
+}
+
+// NewInspection creates a new Inspection instance.
+func NewInspection(minValidity time.Duration, warnOnly bool) *Inspection {
+	return &Inspection{
+		logger:      log.WithField("type", "inspection"),
+		minValidity: minValidity,
+		warnOnly:    warnOnly,
+		now:         time.Now,
+	}
+}
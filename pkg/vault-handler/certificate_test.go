@@ -0,0 +1,77 @@
+package vaulthandler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testChain leaf certificate signed by a CA, both in PEM, and leaf private key.
+func testChain(t *testing.T) ([]byte, []byte, []byte) {
+	ca, caKey := testCertificate(t, time.Now().Add(365*24*time.Hour), nil)
+	leaf, key := testCertificate(t, time.Now().Add(90*24*time.Hour), newTestIssuer(t, ca, caKey))
+	return leaf, ca, key
+}
+
+// tlsFiles certificate and key as downloaded files of group "tls".
+func tlsFiles(crt, key []byte) []*File {
+	return []*File{
+		NewFile("tls", "", &SecretData{Name: "tls.crt"}, crt),
+		NewFile("tls", "", &SecretData{Name: "tls.key"}, key),
+		NewFile("tls", "", &SecretData{Name: "other"}, []byte("not a certificate")),
+	}
+}
+
+func TestInspectionCheck(t *testing.T) {
+	leaf, ca, key := testChain(t)
+
+	i := NewInspection(30*24*time.Hour, false)
+	assert.Nil(t, i.Check(tlsFiles(append(leaf, ca...), key)))
+	assert.Len(t, i.Reports, 1)
+	assert.Equal(t, "CN=leaf", i.Reports[0].Subject)
+	assert.Len(t, i.Reports[0].Problems, 0)
+	assert.True(t, i.Reports[0].Remaining > 89*24*time.Hour)
+
+	// chain in wrong order, and mismatched key
+	_, otherKey := testCertificate(t, time.Now().Add(time.Hour), nil)
+	i = NewInspection(0, false)
+	err := i.Check(tlsFiles(append(ca, leaf...), otherKey))
+	assert.NotNil(t, err)
+	assert.Len(t, i.Reports[0].Problems, 2)
+
+	// expiring before minimum validity
+	i = NewInspection(120*24*time.Hour, false)
+	assert.NotNil(t, i.Check(tlsFiles(leaf, key)))
+	assert.Contains(t, i.Reports[0].Problems[0], "less than minimum")
+
+	// expired, only warning
+	expired, expiredKey := testCertificate(t, time.Now().Add(-time.Hour), nil)
+	i = NewInspection(0, true)
+	assert.Nil(t, i.Check(tlsFiles(expired, expiredKey)))
+	assert.Contains(t, i.Reports[0].Problems[0], "expired at")
+}
+
+func TestInspectionCheckCA(t *testing.T) {
+	leaf, ca, key := testChain(t)
+	files := append(tlsFiles(leaf, key), NewFile("tls", "", &SecretData{Name: "ca.crt"}, ca))
+
+	i := NewInspection(0, false)
+	assert.Nil(t, i.Check(files))
+	assert.Len(t, i.Reports, 2)
+	assert.Equal(t, "CN=ca", i.Reports[1].Subject)
+	assert.Len(t, i.Reports[1].Problems, 0)
+}
+
+func TestInspectionPrivateKeyFile(t *testing.T) {
+	_, _, key := testChain(t)
+
+	cert := NewFile("group", "", &SecretData{Name: "server.crt"}, nil)
+	named := NewFile("group", "", &SecretData{Name: "server.key"}, key)
+	other := NewFile("group", "", &SecretData{Name: "client.key"}, key)
+
+	assert.Equal(t, named, privateKeyFile(cert, []*File{other, named}))
+	assert.Nil(t, privateKeyFile(cert, []*File{other}))
+	assert.Nil(t, privateKeyFile(NewFile("group", "", &SecretData{Name: "server"}, nil), []*File{named}))
+	assert.Nil(t, privateKeyFile(cert, []*File{}))
+}
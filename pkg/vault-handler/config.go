@@ -2,22 +2,47 @@ package vaulthandler
 
 import (
 	"fmt"
+	"path"
+	"time"
+
+	log "github.com/sirupsen/logrus"
 )
 
 // Config object for vault-handler.
 type Config struct {
-	DryRun        bool   // dry-run flag
-	OutputDir     string // output directory path
-	InputDir      string // input directory, when uploading
-	DotEnv        bool   // create a dot-env file with secrets
-	VaultAddr     string // vault api endpoint
-	VaultToken    string // vault token
-	VaultRoleID   string // vault approle role-id
-	VaultSecretID string // vault approle secret-id
-	InCluster     bool   // kubernetes in-cluster
-	Context       string // kubernetes context
-	Namespace     string // kubernetes namespace
-	KubeConfig    string // kubernetes config
+	DryRun           bool          // dry-run flag
+	OutputDir        string        // output directory path
+	InputDir         string        // input directory, when uploading
+	CAS              bool          // check-and-set uploads, on kv-v2
+	Strategy         string        // default upload strategy
+	DiffTarget       string        // diff target, vault or kubernetes
+	RenderFormat     string        // render output format
+	DotEnv           bool          // create a dot-env file with secrets
+	WatchInterval    time.Duration // interval between downloads, on watch
+	WatchJitter      time.Duration // maximum random delay added to watch interval
+	ReloadPID        int           // process id to signal after secrets changed, on watch
+	ReloadSignal     string        // signal sent to reload process
+	ReloadURL        string        // url to post after secrets changed, on watch
+	ExecPrefix       string        // environment variable name prefix, on exec
+	ExecRestart      bool          // restart child process when secrets change, on exec
+	VaultAddr        string        // vault api endpoint
+	VaultAuthMethod  string        // vault authentication method
+	VaultAuthOptions AuthOptions   // vault authentication method options
+	VaultKeepToken   bool          // do not revoke token obtained via login on shutdown
+	Prune            bool          // prune kubernetes secrets removed from manifest
+	PruneAll         bool          // prune looking for owned secrets on all namespaces
+	CertInspect      bool          // inspect certificates and keys before writing, on download and copy
+	CertMinValidity  time.Duration // minimum remaining validity of certificates inspected
+	CertWarnOnly     bool          // only warn about certificate problems
+	WebhookListen    string        // webhook listen address
+	WebhookTLSCert   string        // webhook tls certificate file
+	WebhookTLSKey    string        // webhook tls key file
+	WebhookImage     string        // vault-handler image injected by webhook
+	WebhookMountPath string        // path secrets are mounted on containers injected by webhook
+	InCluster        bool          // kubernetes in-cluster
+	Context          string        // kubernetes context
+	Namespace        string        // kubernetes namespace
+	KubeConfig       string        // kubernetes config
 }
 
 // Validate configuration object.
@@ -25,11 +50,20 @@ func (c *Config) Validate() error {
 	if c.VaultAddr == "" {
 		return fmt.Errorf("vault-addr is not informed")
 	}
-	if c.VaultToken == "" && c.VaultRoleID == "" && c.VaultSecretID == "" {
-		return fmt.Errorf("inform vault-token, or vault-role-id and secret-id")
+	if err := c.validateAuthMethod(); err != nil {
+		return err
+	}
+	if c.Strategy != "" && !isUploadStrategy(c.Strategy) {
+		return fmt.Errorf("strategy '%s' is not supported, use replace, merge or patch", c.Strategy)
+	}
+	if c.DiffTarget != "" && c.DiffTarget != VaultDiffTarget && c.DiffTarget != KubernetesDiffTarget {
+		return fmt.Errorf("diff target '%s' is not supported, use vault or kubernetes", c.DiffTarget)
+	}
+	if c.RenderFormat != "" && c.RenderFormat != K8sYAMLFormat {
+		return fmt.Errorf("render format '%s' is not supported, use %s", c.RenderFormat, K8sYAMLFormat)
 	}
-	if c.VaultToken != "" && (c.VaultRoleID != "" || c.VaultSecretID != "") {
-		return fmt.Errorf("vault-token can't be used in combination with role-id or secret-id")
+	if c.CertMinValidity < 0 {
+		return fmt.Errorf("certificate minimum validity must not be negative")
 	}
 	if c.InputDir != "" && !isDir(c.InputDir) {
 		return fmt.Errorf("input-dir '%s' is not found", c.InputDir)
@@ -40,14 +74,127 @@ func (c *Config) Validate() error {
 	return nil
 }
 
+// AuthMethod returns the informed authentication method, or infer it from the options informed.
+func (c *Config) AuthMethod() (AuthMethod, error) {
+	if c.VaultAuthMethod != "" {
+		return GetAuthMethod(c.VaultAuthMethod)
+	}
+	return inferAuthMethod(c.VaultAuthOptions)
+}
+
+// validateAuthMethod load credentials from files, and check if options informed are in line with
+// authentication method. When no credentials are informed, it looks for a existing token file.
+func (c *Config) validateAuthMethod() error {
+	if c.VaultAuthOptions == nil {
+		c.VaultAuthOptions = AuthOptions{}
+	}
+	if err := resolveAuthFiles(c.VaultAuthOptions); err != nil {
+		return err
+	}
+	if err := c.detectToken(); err != nil {
+		return err
+	}
+
+	method, err := c.AuthMethod()
+	if err != nil {
+		return err
+	}
+	return validateAuthOptions(method, c.VaultAuthOptions)
+}
+
+// detectToken load token from a well known location, when no credentials are informed.
+func (c *Config) detectToken() error {
+	if c.VaultAuthMethod != "" && c.VaultAuthMethod != TokenAuthMethod {
+		return nil
+	}
+	for _, option := range AuthOptionsFlags() {
+		if value := c.VaultAuthOptions[option.Name]; value != "" && value != option.Default {
+			return nil
+		}
+	}
+
+	tokenFile := detectTokenFile()
+	if tokenFile == "" {
+		return nil
+	}
+	log.WithField("path", tokenFile).Info("Using Vault token found on file-system")
+	token, err := readCredentialFile(tokenFile)
+	if err != nil {
+		return err
+	}
+	c.VaultAuthOptions["vault-token"] = token
+	return nil
+}
+
+// ValidateWatch configuration related to watch mode.
+func (c *Config) ValidateWatch() error {
+	if c.WatchInterval <= 0 {
+		return fmt.Errorf("watch interval must be greater than zero")
+	}
+	if c.WatchJitter < 0 {
+		return fmt.Errorf("watch jitter must not be negative")
+	}
+	if c.ReloadPID > 0 {
+		if _, err := parseSignal(c.ReloadSignal); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reload settings, when process or url is informed.
+func (c *Config) reload() *Reload {
+	if c.ReloadPID <= 0 && c.ReloadURL == "" {
+		return nil
+	}
+	return &Reload{
+		PID:     c.ReloadPID,
+		Signal:  c.ReloadSignal,
+		URL:     c.ReloadURL,
+		Timeout: c.WatchInterval,
+	}
+}
+
+// ValidateWebhook configuration related to webhook mode, which does not use Vault credentials.
+func (c *Config) ValidateWebhook() error {
+	if c.VaultAddr == "" {
+		return fmt.Errorf("vault-addr is not informed")
+	}
+	if c.WebhookImage == "" {
+		return fmt.Errorf("image is not informed")
+	}
+	if !path.IsAbs(c.WebhookMountPath) {
+		return fmt.Errorf("mount-path '%s' must be absolute", c.WebhookMountPath)
+	}
+	for _, file := range []string{c.WebhookTLSCert, c.WebhookTLSKey} {
+		if !FileExists(file) {
+			return fmt.Errorf("can't find tls file at '%s'", file)
+		}
+	}
+	return nil
+}
+
 // ValidateKubernetes configuration related to Kubernetes.
 func (c *Config) ValidateKubernetes() error {
-	if c.InCluster && c.Context != "" {
-		return fmt.Errorf("configuration 'context' cannot be used in combination with 'in-cluster'")
-	}
 	if c.Namespace == "" {
 		return fmt.Errorf("namespace is not informed")
 	}
+	return c.validateKubeClient()
+}
+
+// ValidateController configuration related to controller mode, namespace is optional.
+func (c *Config) ValidateController() error {
+	if c.WatchInterval <= 0 {
+		return fmt.Errorf("refresh interval must be greater than zero")
+	}
+	return c.validateKubeClient()
+}
+
+// validateKubeClient configuration employed to instantiate Kubernetes api-client.
+func (c *Config) validateKubeClient() error {
+	if c.InCluster && c.Context != "" {
+		return fmt.Errorf("configuration 'context' cannot be used in combination with 'in-cluster'")
+	}
 	if c.KubeConfig != "" && !FileExists(c.KubeConfig) {
 		return fmt.Errorf("can't find kube-config file at '%s'", c.KubeConfig)
 	}
@@ -1,7 +1,10 @@
 package vaulthandler
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -14,10 +17,56 @@ func TestConfigValidate(t *testing.T) {
 
 	config.OutputDir = "../../test"
 	config.VaultAddr = "http://127.0.0.1:8200"
-	config.VaultToken = "token"
+	config.VaultAuthOptions = AuthOptions{"vault-token": "token"}
 
 	err = config.Validate()
 	assert.Nil(t, err)
+
+	config.VaultAuthMethod = KubernetesAuthMethod
+	err = config.Validate()
+	assert.NotNil(t, err)
+
+	config.VaultAuthOptions = AuthOptions{
+		"vault-k8s-role":       "role",
+		"vault-k8s-token-path": "../../should/not/exist",
+	}
+	err = config.Validate()
+	assert.NotNil(t, err)
+
+	config.VaultAuthOptions["vault-k8s-token-path"] = "../../test/manifest.yaml"
+	err = config.Validate()
+	assert.Nil(t, err)
+
+	config.VaultAuthMethod = "unknown"
+	err = config.Validate()
+	assert.NotNil(t, err)
+}
+
+func TestConfigValidateCredentialFiles(t *testing.T) {
+	f, err := ioutil.TempFile("", "vault-handler-token")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("token-from-file")
+	assert.Nil(t, err)
+	assert.Nil(t, os.Chmod(f.Name(), 0600))
+
+	config := &Config{
+		VaultAddr:        "http://127.0.0.1:8200",
+		VaultAuthOptions: AuthOptions{"vault-token-file": f.Name()},
+	}
+	err = config.Validate()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-from-file", config.VaultAuthOptions["vault-token"])
+
+	// validating again keeps the resolved token
+	err = config.Validate()
+	assert.Nil(t, err)
+	assert.Equal(t, "token-from-file", config.VaultAuthOptions["vault-token"])
+
+	config.VaultAuthOptions = AuthOptions{"vault-token": "token", "vault-token-file": f.Name()}
+	err = config.Validate()
+	assert.NotNil(t, err)
 }
 
 func TestConfigValidateKubernetes(t *testing.T) {
@@ -39,3 +88,23 @@ func TestConfigValidateKubernetes(t *testing.T) {
 	err = config.ValidateKubernetes()
 	assert.Nil(t, err)
 }
+
+func TestConfigValidateWatch(t *testing.T) {
+	config := &Config{}
+
+	err := config.ValidateWatch()
+	assert.NotNil(t, err)
+
+	config.WatchInterval = time.Minute
+	config.ReloadPID = 1
+	config.ReloadSignal = "unknown"
+
+	err = config.ValidateWatch()
+	assert.NotNil(t, err)
+
+	config.ReloadSignal = "HUP"
+
+	err = config.ValidateWatch()
+	assert.Nil(t, err)
+	assert.NotNil(t, config.reload())
+}
@@ -0,0 +1,333 @@
+package vaulthandler
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+const (
+	// VaultSecretKind custom resource kind.
+	VaultSecretKind = "VaultSecret"
+	// SyncedCondition status condition type, informing if secret is in sync with Vault.
+	SyncedCondition = "Synced"
+	// AllowedPathsAnnotation namespace annotation with comma separated Vault path prefixes that
+	// VaultSecret resources on the namespace are allowed to read.
+	AllowedPathsAnnotation = "vault-handler/allowed-paths"
+)
+
+// VaultSecretResource group, version and resource of VaultSecret custom resource.
+var VaultSecretResource = schema.GroupVersionResource{
+	Group:    "vault-handler.otaviof.github.io",
+	Version:  "v1alpha1",
+	Resource: "vaultsecrets",
+}
+
+// Controller reconciles VaultSecret custom resources into Kubernetes secrets, using the same logic
+// than download and copy. The resource spec is a manifest secrets group, named after the resource.
+type Controller struct {
+	logger    *log.Entry                      // logger
+	handler   *Handler                        // handler instance, with vault api
+	kube      *Kubernetes                     // kubernetes api-client instance
+	client    dynamic.Interface               // dynamic client, for custom resources
+	namespace string                          // namespace to watch, empty means all
+	interval  time.Duration                   // refresh interval
+	queue     workqueue.RateLimitingInterface // queue of resource keys to reconcile
+}
+
+// Run watch custom resources, reconciling them until stop channel is closed.
+func (c *Controller) Run(stop <-chan struct{}) error {
+	defer c.queue.ShutDown()
+
+	resource := c.client.Resource(VaultSecretResource).Namespace(c.namespace)
+	informer := cache.NewSharedIndexInformer(&cache.ListWatch{
+		ListFunc: func(opts metav1.ListOptions) (runtime.Object, error) {
+			return resource.List(opts)
+		},
+		WatchFunc: func(opts metav1.ListOptions) (watch.Interface, error) {
+			return resource.Watch(opts)
+		},
+	}, &unstructured.Unstructured{}, 0, cache.Indexers{})
+
+	informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: c.enqueue,
+		UpdateFunc: func(old, obj interface{}) {
+			// status updates don't change generation, and must not trigger reconciliation
+			if old.(*unstructured.Unstructured).GetGeneration() !=
+				obj.(*unstructured.Unstructured).GetGeneration() {
+				c.enqueue(obj)
+			}
+		},
+	})
+
+	c.logger.Info("Starting controller")
+	go informer.Run(stop)
+	if !cache.WaitForCacheSync(stop, informer.HasSynced) {
+		return fmt.Errorf("unable to sync informer cache")
+	}
+
+	go wait.Until(c.worker, time.Second, stop)
+	<-stop
+	c.logger.Info("Stopping controller")
+	return nil
+}
+
+// enqueue resource key for reconciliation.
+func (c *Controller) enqueue(obj interface{}) {
+	key, err := cache.MetaNamespaceKeyFunc(obj)
+	if err != nil {
+		c.logger.Errorf("Unable to extract key: '%s'", err)
+		return
+	}
+	c.queue.Add(key)
+}
+
+// worker process queue items, until queue is shut down.
+func (c *Controller) worker() {
+	for c.processNextItem() {
+	}
+}
+
+// processNextItem reconcile a queued resource, requeueing it with rate limit on errors, or after
+// refresh interval otherwise.
+func (c *Controller) processNextItem() bool {
+	item, shutdown := c.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer c.queue.Done(item)
+
+	key := item.(string)
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		c.logger.Errorf("Unable to split key '%s': '%s'", key, err)
+		c.queue.Forget(item)
+		return true
+	}
+
+	found, err := c.Reconcile(namespace, name)
+	if err != nil {
+		c.logger.WithField("key", key).Errorf("On reconciling: '%s'", err)
+		c.queue.AddRateLimited(item)
+		return true
+	}
+	c.queue.Forget(item)
+	if found {
+		c.queue.AddAfter(item, c.interval)
+	}
+	return true
+}
+
+// Reconcile VaultSecret resource into a Kubernetes secret, updating resource status. Returns false
+// when resource is not found.
+func (c *Controller) Reconcile(namespace, name string) (bool, error) {
+	var obj *unstructured.Unstructured
+	var secrets Secrets
+	var version int
+	var err error
+
+	logger := c.logger.WithFields(log.Fields{"namespace": namespace, "name": name})
+	logger.Info("Reconciling")
+
+	resource := c.client.Resource(VaultSecretResource).Namespace(namespace)
+	if obj, err = resource.Get(name, metav1.GetOptions{}); err != nil {
+		if errors.IsNotFound(err) {
+			logger.Info("Resource is not found, secret is garbage collected")
+			return false, nil
+		}
+		return true, err
+	}
+
+	if secrets, err = vaultSecretSpec(obj); err == nil {
+		version, err = c.sync(obj, secrets)
+	}
+	if statusErr := c.updateStatus(obj, version, err); statusErr != nil {
+		logger.Errorf("On updating status: '%s'", statusErr)
+	}
+	return true, err
+}
+
+// sync download secrets from Vault and copy them into resource namespace, returning the highest
+// secret version read.
+func (c *Controller) sync(obj *unstructured.Unstructured, secrets Secrets) (int, error) {
+	var version int
+	var err error
+
+	namespace := obj.GetNamespace()
+	name := obj.GetName()
+
+	// secrets are always written on resource namespace
+	secrets.Namespace = namespace
+	secrets.Namespaces = nil
+	resource := fmt.Sprintf("%s/%s/%s", VaultSecretKind, namespace, name)
+	manifest := &Manifest{File: resource, Name: resource, Secrets: map[string]Secrets{name: secrets}}
+
+	if err = manifest.ValidateKubernetes(); err != nil {
+		return 0, err
+	}
+	if err = c.authorize(namespace, secrets); err != nil {
+		return 0, err
+	}
+
+	d := NewDownload(c.handler.vault, "")
+	logger := c.logger.WithFields(log.Fields{"action": "reconcile", "namespace": namespace})
+	if err = c.handler.loop(logger, manifest, d.Prepare); err != nil {
+		return 0, err
+	}
+	for _, file := range d.Files {
+		if file.Version > version {
+			version = file.Version
+		}
+	}
+
+	cp := NewCopy(c.kube, d, manifest, namespace)
+	cp.SetOwner(metav1.OwnerReference{
+		APIVersion: VaultSecretResource.GroupVersion().String(),
+		Kind:       VaultSecretKind,
+		Name:       name,
+		UID:        obj.GetUID(),
+	})
+	if err = cp.Prepare(); err != nil {
+		return version, err
+	}
+	return version, cp.Execute(c.handler.cfg.DryRun)
+}
+
+// authorize Vault paths read by resource against prefixes allowed on namespace annotation. Namespaces
+// without the annotation are not allowed to read any path.
+func (c *Controller) authorize(namespace string, secrets Secrets) error {
+	ns, err := c.kube.clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	var prefixes []string
+	for _, prefix := range strings.Split(ns.Annotations[AllowedPathsAnnotation], ",") {
+		if prefix = strings.Trim(strings.TrimSpace(prefix), "/"); prefix != "" {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	if len(prefixes) == 0 {
+		return fmt.Errorf("namespace '%s' is not allowed to read Vault paths, annotation '%s' "+
+			"is not informed", namespace, AllowedPathsAnnotation)
+	}
+
+	for _, data := range secrets.Data {
+		vaultPath := c.handler.vault.composePath(data, secrets.Path)
+		if !pathAllowed(vaultPath, prefixes) {
+			return fmt.Errorf("vault path '%s' is not allowed on namespace '%s', allowed prefixes "+
+				"are '%s'", vaultPath, namespace, strings.Join(prefixes, ", "))
+		}
+	}
+	return nil
+}
+
+// pathAllowed checks if Vault path is equal to, or below, one of the prefixes. Paths that are not in
+// canonical form, like carrying "..", are never allowed.
+func pathAllowed(vaultPath string, prefixes []string) bool {
+	trimmed := strings.Trim(vaultPath, "/")
+	if trimmed == "" || path.Clean(trimmed) != trimmed {
+		return false
+	}
+	for _, prefix := range prefixes {
+		if trimmed == prefix || strings.HasPrefix(trimmed, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// updateStatus of resource with synced condition, last version read and error.
+func (c *Controller) updateStatus(obj *unstructured.Unstructured, version int, syncErr error) error {
+	condition := map[string]interface{}{
+		"type":    SyncedCondition,
+		"status":  "True",
+		"reason":  "Synced",
+		"message": "Secret is in sync with Vault",
+	}
+	status := map[string]interface{}{
+		"observedGeneration": obj.GetGeneration(),
+		"lastVersion":        int64(version),
+		"lastSyncTime":       time.Now().UTC().Format(time.RFC3339),
+	}
+	if syncErr != nil {
+		condition["status"] = "False"
+		condition["reason"] = "Error"
+		condition["message"] = syncErr.Error()
+		status["error"] = syncErr.Error()
+	}
+
+	// transition time only changes together with condition status
+	condition["lastTransitionTime"] = status["lastSyncTime"]
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	for _, existing := range conditions {
+		if previous, ok := existing.(map[string]interface{}); ok &&
+			previous["type"] == SyncedCondition && previous["status"] == condition["status"] &&
+			previous["lastTransitionTime"] != nil {
+			condition["lastTransitionTime"] = previous["lastTransitionTime"]
+		}
+	}
+	status["conditions"] = []interface{}{condition}
+
+	if err := unstructured.SetNestedField(obj.Object, status, "status"); err != nil {
+		return err
+	}
+	_, err := c.client.Resource(VaultSecretResource).Namespace(obj.GetNamespace()).UpdateStatus(obj)
+	return err
+}
+
+// vaultSecretSpec parse resource spec as a manifest secrets group.
+func vaultSecretSpec(obj *unstructured.Unstructured) (Secrets, error) {
+	var secrets Secrets
+
+	spec, found, err := unstructured.NestedMap(obj.Object, "spec")
+	if err != nil {
+		return secrets, err
+	}
+	if !found {
+		return secrets, fmt.Errorf("spec is not found")
+	}
+
+	// spec follows the same schema than manifest, so it's parsed the same way
+	payload, err := yaml.Marshal(spec)
+	if err != nil {
+		return secrets, err
+	}
+	if err = yaml.UnmarshalStrict(payload, &secrets); err != nil {
+		return secrets, err
+	}
+	if secrets.Path == "" {
+		return secrets, fmt.Errorf("spec.path is not informed")
+	}
+	return secrets, nil
+}
+
+// NewController creates a new Controller instance, watching informed namespace, or all namespaces
+// when empty.
+func NewController(
+	handler *Handler, kube *Kubernetes, client dynamic.Interface, namespace string, interval time.Duration,
+) *Controller {
+	return &Controller{
+		logger:    log.WithFields(log.Fields{"type": "controller", "namespace": namespace}),
+		handler:   handler,
+		kube:      kube,
+		client:    client,
+		namespace: namespace,
+		interval:  interval,
+		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+	}
+}
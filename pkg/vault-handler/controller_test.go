@@ -0,0 +1,137 @@
+package vaulthandler
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func newVaultSecret(spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": VaultSecretResource.GroupVersion().String(),
+		"kind":       VaultSecretKind,
+		"metadata": map[string]interface{}{
+			"name":       "app",
+			"namespace":  "team",
+			"uid":        "uid",
+			"generation": int64(1),
+		},
+		"spec": spec,
+	}}
+}
+
+// newNamespace with allowed paths annotation, when informed.
+func newNamespace(name, allowedPaths string) *corev1.Namespace {
+	ns := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name}}
+	if allowedPaths != "" {
+		ns.Annotations = map[string]string{AllowedPathsAnnotation: allowedPaths}
+	}
+	return ns
+}
+
+func TestControllerReconcile(t *testing.T) {
+	m, v := newMockKV(t)
+	defer m.server.Close()
+	m.secrets["app"] = []map[string]interface{}{{"password": "first"}, {"password": "second"}}
+
+	obj := newVaultSecret(map[string]interface{}{
+		"path":   "kv/app",
+		"labels": map[string]interface{}{"team": "team"},
+		"data":   []interface{}{map[string]interface{}{"name": "password"}},
+	})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+	kube := &Kubernetes{
+		logger:    log.WithField("test", "controller"),
+		clientset: fake.NewSimpleClientset(newNamespace("team", "kv/other, /kv/app/")),
+	}
+	handler := &Handler{logger: log.WithField("test", "controller"), cfg: &Config{}, vault: v}
+
+	c := NewController(handler, kube, client, "", time.Minute)
+	found, err := c.Reconcile("team", "app")
+	assert.Nil(t, err)
+	assert.True(t, found)
+
+	secret, err := kube.SecretGet("team", "app")
+	assert.Nil(t, err)
+	assert.NotNil(t, secret)
+	assert.Equal(t, []byte("second"), secret.Data["password"])
+	assert.Equal(t, "team", secret.Labels["team"])
+	assert.Equal(t, VaultSecretKind, secret.OwnerReferences[0].Kind)
+
+	updated, err := client.Resource(VaultSecretResource).Namespace("team").Get("app", metav1.GetOptions{})
+	assert.Nil(t, err)
+	version, _, _ := unstructured.NestedInt64(updated.Object, "status", "lastVersion")
+	assert.Equal(t, int64(2), version)
+	conditions, _, _ := unstructured.NestedSlice(updated.Object, "status", "conditions")
+	assert.Len(t, conditions, 1)
+	assert.Equal(t, "True", conditions[0].(map[string]interface{})["status"])
+
+	// missing resources are not requeued
+	found, err = c.Reconcile("team", "missing")
+	assert.Nil(t, err)
+	assert.False(t, found)
+}
+
+func TestControllerReconcileError(t *testing.T) {
+	obj := newVaultSecret(map[string]interface{}{"data": []interface{}{}})
+	client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj)
+	handler := &Handler{logger: log.WithField("test", "controller"), cfg: &Config{}}
+
+	c := NewController(handler, nil, client, "", time.Minute)
+	_, err := c.Reconcile("team", "app")
+	assert.NotNil(t, err)
+
+	updated, err := client.Resource(VaultSecretResource).Namespace("team").Get("app", metav1.GetOptions{})
+	assert.Nil(t, err)
+	message, _, _ := unstructured.NestedString(updated.Object, "status", "error")
+	assert.Equal(t, "spec.path is not informed", message)
+}
+
+func TestControllerReconcileForbidden(t *testing.T) {
+	obj := newVaultSecret(map[string]interface{}{
+		"path": "kv/app",
+		"data": []interface{}{map[string]interface{}{"name": "password"}},
+	})
+	handler := &Handler{logger: log.WithField("test", "controller"), cfg: &Config{}}
+
+	for allowedPaths, message := range map[string]string{
+		"": "namespace 'team' is not allowed to read Vault paths, " +
+			"annotation 'vault-handler/allowed-paths' is not informed",
+		"kv/ap,kv/app/sub": "vault path 'kv/app' is not allowed on namespace 'team', " +
+			"allowed prefixes are 'kv/ap, kv/app/sub'",
+	} {
+		client := dynamicfake.NewSimpleDynamicClient(runtime.NewScheme(), obj.DeepCopy())
+		kube := &Kubernetes{
+			logger:    log.WithField("test", "controller"),
+			clientset: fake.NewSimpleClientset(newNamespace("team", allowedPaths)),
+		}
+
+		c := NewController(handler, kube, client, "", time.Minute)
+		_, err := c.Reconcile("team", "app")
+		assert.NotNil(t, err)
+
+		updated, err := client.Resource(VaultSecretResource).Namespace("team").Get("app", metav1.GetOptions{})
+		assert.Nil(t, err)
+		conditions, _, _ := unstructured.NestedSlice(updated.Object, "status", "conditions")
+		assert.Equal(t, "False", conditions[0].(map[string]interface{})["status"])
+		assert.Equal(t, message, conditions[0].(map[string]interface{})["message"])
+	}
+}
+
+func TestControllerPathAllowed(t *testing.T) {
+	prefixes := []string{"kv/team"}
+	assert.True(t, pathAllowed("kv/team", prefixes))
+	assert.True(t, pathAllowed("/kv/team/app", prefixes))
+	assert.False(t, pathAllowed("kv/teams", prefixes))
+	assert.False(t, pathAllowed("kv/team/../other", prefixes))
+	assert.False(t, pathAllowed("kv/team//app", prefixes))
+	assert.False(t, pathAllowed("kv", prefixes))
+}
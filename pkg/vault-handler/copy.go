@@ -1,113 +1,486 @@
 package vaulthandler
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
-	"reflect"
+	"sort"
+	"strconv"
 
 	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
+const (
+	// ManagedByLabel label stamped on secrets created by vault-handler.
+	ManagedByLabel = "app.kubernetes.io/managed-by"
+	// ManagedByValue value of managed-by label.
+	ManagedByValue = "vault-handler"
+	// ManifestLabel identifies the manifest owning the secret, used for pruning.
+	ManifestLabel = "vault-handler/manifest-id"
+	// VaultPathAnnotation source vault path.
+	VaultPathAnnotation = "vault-handler/vault-path"
+	// KVVersionAnnotation key-value secrets engine version of source vault path.
+	KVVersionAnnotation = "vault-handler/kv-version"
+	// ManifestAnnotation manifest file secret is described in.
+	ManifestAnnotation = "vault-handler/manifest"
+	// ContentHashAnnotation hash of secret type and data, used to detect drift.
+	ContentHashAnnotation = "vault-handler/content-hash"
+)
+
+// secretRef namespace and name of a kubernetes secret.
+type secretRef struct {
+	namespace string // kubernetes namespace
+	name      string // secret name, same as group name
+}
+
+// ownedRef kind, namespace and name of a kubernetes object owned by manifest.
+type ownedRef struct {
+	kind      string // kubernetes kind
+	namespace string // kubernetes namespace
+	name      string // object name
+}
+
 // Copy secrets to Kubernetes, by receiving Vault files, and comparing with existing data.
 type Copy struct {
-	logger     *log.Entry                   // logger
-	kube       *Kubernetes                  // kubernetes api-client instance
-	download   *Download                    // downloaded data from Vault
-	secretType map[string]string            // kubernetes secret-type per group
-	data       map[string]map[string][]byte // group as first key, filename as second key
+	logger     *log.Entry                      // logger
+	kube       *Kubernetes                     // kubernetes api-client instance
+	download   *Download                       // downloaded data from Vault
+	manifest   *Manifest                       // manifest describing secrets
+	namespace  string                          // default kubernetes namespace
+	secretType map[string]string               // kubernetes secret-type per group
+	meta       map[secretRef]metav1.ObjectMeta // kubernetes secret metadata
+	data       map[secretRef]map[string][]byte // secret as first key, filename as second key
+	changed    map[secretRef]bool              // secrets created or with data changed
+	owners     []metav1.OwnerReference         // owner references added to secrets
+	Changes    []*Change                       // changes found between vault and kubernetes
+	Restarts   []string                        // workloads restarted after secrets changed
 }
 
 // Prepare by looking at Kubernetes secrets and checking if they are different from whats downloaded
-// from Vault, the ones that are different, are stored to be persisted later.
+// from Vault, the ones that are different, are stored to be persisted later. Each group is compared
+// on every namespace it targets.
 func (c *Copy) Prepare() error {
 	var err error
 
-	// organizing files by groups, group is the kubernetes secret name
-	data := make(map[string][]*File)
-	for _, file := range c.download.Files {
-		data[file.Group] = append(data[file.Group], file)
-	}
-
-	for group, files := range data {
-		if len(files) > 0 {
-			c.secretType[group] = c.download.Files[0].SecretType
-			c.logger.Infof("Setting secret type as '%s'", c.secretType[group])
+	groups, data := c.groupFiles()
+	for _, group := range groups {
+		files := data[group]
+		if err = c.setSecretType(group, files[0]); err != nil {
+			return err
 		}
-		if err = c.compare(group, files); err != nil {
+		if err = c.validateData(group, files); err != nil {
 			return err
 		}
+
+		namespaces := c.namespaces(group)
+		if len(namespaces) == 0 {
+			return fmt.Errorf("namespace is not informed for group '%s'", group)
+		}
+		for _, namespace := range namespaces {
+			if err = c.compare(namespace, group, files); err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
 }
 
-// Execute inspect collected data during Prepare and create a kubernetes secret.
+// Execute inspect collected data during Prepare and create a kubernetes secret, or config-map. Then
+// workloads depending on changed secrets are restarted.
 func (c *Copy) Execute(dryRun bool) error {
 	var err error
 
-	for group, data := range c.data {
-		c.logger.Infof("Creating Kubernetes secret '%s'", group)
+	for ref, data := range c.data {
+		kind := c.kind(ref.name)
+		c.logger.Infof("Creating Kubernetes %s '%s/%s'", kind, ref.namespace, ref.name)
 		if dryRun {
-			c.logger.Infof("[DRY-RUN] Kubernetes secret '%s'", group)
+			c.logger.Infof("[DRY-RUN] Kubernetes %s '%s/%s'", kind, ref.namespace, ref.name)
 			continue
 		}
-		if err = c.kube.SecretWrite(group, c.secretType[group], data); err != nil {
+		if kind == ConfigMapKind {
+			err = c.kube.ConfigMapWrite(ref.namespace, c.meta[ref], data)
+		} else {
+			err = c.kube.SecretWrite(ref.namespace, c.meta[ref], c.secretType[ref.name], data)
+		}
+		if err != nil {
 			return err
 		}
 	}
+	if err = c.restart(dryRun); err != nil {
+		return err
+	}
+
+	c.logger.WithFields(log.Fields{
+		"written":      len(c.data),
+		"restarted":    len(c.Restarts),
+		"certificates": len(c.download.Certificates),
+	}).Info("Copy summary")
+	for _, restart := range c.Restarts {
+		c.logger.Infof("Restarted workload '%s'", restart)
+	}
+	logCertificates(c.logger, c.download.Certificates)
 	return nil
 }
 
-// compare with secret present in kubernetes, saving the non-existing of different entries.
-func (c *Copy) compare(group string, files []*File) error {
-	var kubeSecrets map[string][]byte
-	var vaultSecrets = make(map[string][]byte)
-	var exists bool
+// restart workloads depending on changed secrets, patching pod-template annotations with secrets
+// content hash. Each workload is patched only once, carrying the hash of all changed groups.
+func (c *Copy) restart(dryRun bool) error {
+	var targets []workloadTarget
+	var found []workload
 	var err error
 
-	logger := c.logger.WithField("group", group)
+	annotations := make(map[workloadTarget]map[string]string)
+	for ref := range c.changed {
+		workloads := c.manifest.Secrets[ref.name].Workloads
+		if workloads.Empty() {
+			continue
+		}
+		if found, err = c.kube.Workloads(ref.namespace, workloads); err != nil {
+			return err
+		}
+		for _, w := range found {
+			target := workloadTarget{namespace: ref.namespace, workload: w}
+			if _, exists := annotations[target]; !exists {
+				annotations[target] = make(map[string]string)
+				targets = append(targets, target)
+			}
+			annotations[target][ChecksumAnnotationPrefix+ref.name] =
+				c.meta[ref].Annotations[ContentHashAnnotation]
+		}
+	}
+	sort.Slice(targets, func(i, j int) bool { return targets[i].String() < targets[j].String() })
 
-	logger.Info("Organizing Vault secrets in the same way than Kubernetes")
-	for _, file := range files {
-		var exists bool
+	for _, target := range targets {
+		if dryRun {
+			c.logger.Infof("[DRY-RUN] Workload '%s' would be restarted", target)
+			c.Restarts = append(c.Restarts, target.String())
+			continue
+		}
+		restarted, err := c.kube.RestartWorkload(target.namespace, target.workload, annotations[target])
+		if err != nil {
+			return err
+		}
+		if !restarted {
+			c.logger.Warnf("Workload '%s' is not found, skipping restart", target)
+			continue
+		}
+		c.Restarts = append(c.Restarts, target.String())
+	}
+	return nil
+}
 
-		if _, exists = vaultSecrets[file.Properties.Name]; exists {
-			return fmt.Errorf("name '%s' was found more than once", file.Properties.Name)
+// setSecretType of group, validating kind. Config-maps have no type, so kind is employed instead.
+func (c *Copy) setSecretType(group string, file *File) error {
+	switch c.kind(group) {
+	case SecretKind:
+		c.secretType[group] = file.SecretType
+		if c.secretType[group] == "" {
+			c.secretType[group] = string(corev1.SecretTypeOpaque)
 		}
-		vaultSecrets[file.Properties.Name] = file.Payload
+	case ConfigMapKind:
+		if file.SecretType != "" {
+			return fmt.Errorf("type '%s' can't be used with kind '%s', on group '%s'",
+				file.SecretType, ConfigMapKind, group)
+		}
+		c.secretType[group] = ConfigMapKind
+	default:
+		return fmt.Errorf("kind '%s' is not supported, on group '%s'", c.kind(group), group)
 	}
+	c.logger.Infof("Setting secret type as '%s'", c.secretType[group])
+	return nil
+}
 
-	logger.Info("Checking if secret exists in Kubernetes")
-	if exists, err = c.kube.SecretExists(group); err != nil {
+// validateData of group against secret type requirements, before anything is written.
+func (c *Copy) validateData(group string, files []*File) error {
+	if c.kind(group) != SecretKind {
+		return nil
+	}
+	data, err := groupData(files)
+	if err != nil {
 		return err
 	}
-	if !exists {
-		logger.Info("Secret does not exist in Kubernetes, yet.")
-		c.data[group] = vaultSecrets
-		return nil
+	if err = validateSecretTypeData(c.secretType[group], data); err != nil {
+		return fmt.Errorf("group '%s': %s", group, err)
+	}
+	return nil
+}
+
+// kind of kubernetes object for group, secret by default.
+func (c *Copy) kind(group string) string {
+	if kind := c.manifest.Secrets[group].Kind; kind != "" {
+		return kind
 	}
+	return SecretKind
+}
 
-	logger.Info("Reading Kubernetes secret...")
-	if kubeSecrets, err = c.kube.SecretRead(group); err != nil {
+// compare with secret, or config-map, present in kubernetes, saving the non-existing of different
+// entries. When the hash of live type and data matches Vault, and metadata is up to date, data is
+// not compared.
+func (c *Copy) compare(namespace, group string, files []*File) error {
+	var existing *metav1.ObjectMeta
+	var vaultSecrets map[string][]byte
+	var kubeSecrets = make(map[string][]byte)
+	var kubeHash string
+	var err error
+
+	logger := c.logger.WithFields(log.Fields{"namespace": namespace, "group": group})
+
+	logger.Info("Organizing Vault secrets in the same way than Kubernetes")
+	if vaultSecrets, err = groupData(files); err != nil {
 		return err
 	}
+	meta := c.objectMeta(group, files[0], secretHash(c.secretType[group], vaultSecrets))
+
+	logger.Infof("Reading Kubernetes %s...", c.kind(group))
+	if existing, kubeHash, kubeSecrets, err = c.existing(namespace, group); err != nil {
+		return err
+	}
+	if existing == nil {
+		logger.Info("Secret does not exist in Kubernetes, yet.")
+	} else if kubeHash == meta.Annotations[ContentHashAnnotation] && hasObjectMeta(*existing, meta) {
+		logger.Info("Secret content hash and metadata are up to date, secrets are the same!")
+		return nil
+	}
 
 	logger.Info("Commparing Vault secrets with Kubernetes...")
-	if !reflect.DeepEqual(vaultSecrets, kubeSecrets) {
+	changes := compareData(group, vaultSecrets, kubeSecrets, true)
+	// content hash covers secret type as well, which is not part of data changes
+	if existing == nil || kubeHash != meta.Annotations[ContentHashAnnotation] {
+		c.changed[secretRef{namespace: namespace, name: group}] = true
+	}
+	if len(changes) > 0 {
 		logger.Info("Secrets are different!")
-		c.data[group] = vaultSecrets
+		for _, change := range changes {
+			change.Namespace = namespace
+		}
+		c.Changes = append(c.Changes, changes...)
+	} else if existing != nil && kubeHash != meta.Annotations[ContentHashAnnotation] {
+		logger.Info("Secrets are the same, secret type is different!")
+	} else {
+		logger.Info("Secrets are the same, metadata is outdated!")
+	}
+
+	ref := secretRef{namespace: namespace, name: group}
+	c.meta[ref] = meta
+	c.data[ref] = vaultSecrets
+	return nil
+}
+
+// groupFiles organize downloaded files by group, returning sorted group names. Group is the
+// kubernetes secret name.
+func (c *Copy) groupFiles() ([]string, map[string][]*File) {
+	var groups []string
+
+	data := make(map[string][]*File)
+	for _, file := range c.download.Files {
+		if _, found := data[file.Group]; !found {
+			groups = append(groups, file.Group)
+		}
+		data[file.Group] = append(data[file.Group], file)
+	}
+	sort.Strings(groups)
+	return groups, data
+}
+
+// groupData key files payload by name, as kubernetes secret data.
+func groupData(files []*File) (map[string][]byte, error) {
+	data := make(map[string][]byte)
+	for _, file := range files {
+		if _, exists := data[file.Properties.Name]; exists {
+			return nil, fmt.Errorf("name '%s' was found more than once", file.Properties.Name)
+		}
+		data[file.Properties.Name] = file.Payload
+	}
+	return data, nil
+}
+
+// existing object metadata, content hash of live type and data, and data in kubernetes, according
+// to group kind. Metadata is nil when object does not exist.
+func (c *Copy) existing(
+	namespace, group string,
+) (*metav1.ObjectMeta, string, map[string][]byte, error) {
+	if c.kind(group) == ConfigMapKind {
+		configMap, err := c.kube.ConfigMapGet(namespace, group)
+		if err != nil || configMap == nil {
+			return nil, "", map[string][]byte{}, err
+		}
+		live := make(map[string][]byte)
+		for name, value := range configMap.Data {
+			live[name] = []byte(value)
+		}
+		for name, payload := range configMap.BinaryData {
+			live[name] = payload
+		}
+		hash := secretHash(ConfigMapKind, live)
+		return &configMap.ObjectMeta, hash, c.kube.configMapData(configMap), nil
+	}
+
+	secret, err := c.kube.SecretGet(namespace, group)
+	if err != nil || secret == nil {
+		return nil, "", map[string][]byte{}, err
+	}
+	hash := secretHash(string(secret.Type), secret.Data)
+	return &secret.ObjectMeta, hash, c.kube.secretData(secret), nil
+}
+
+// namespaces targeted by group, or the default namespace.
+func (c *Copy) namespaces(group string) []string {
+	secrets := c.manifest.Secrets[group]
+	return secrets.TargetNamespaces(c.namespace)
+}
+
+// objectMeta compose secret metadata, with labels and annotations from manifest, and provenance.
+func (c *Copy) objectMeta(group string, file *File, hash string) metav1.ObjectMeta {
+	secrets := c.manifest.Secrets[group]
+	meta := metav1.ObjectMeta{
+		Name:            group,
+		Labels:          c.ownerLabels(),
+		Annotations:     map[string]string{},
+		OwnerReferences: c.owners,
+	}
+	for k, v := range secrets.Labels {
+		meta.Labels[k] = v
+	}
+	for k, v := range secrets.Annotations {
+		meta.Annotations[k] = v
+	}
+
+	meta.Annotations[VaultPathAnnotation] = secrets.Path
+	meta.Annotations[KVVersionAnnotation] = strconv.Itoa(file.KVVersion)
+	meta.Annotations[ManifestAnnotation] = c.manifest.File
+	meta.Annotations[ContentHashAnnotation] = hash
+	return meta
+}
+
+// Prune delete secrets and config-maps owned by manifest, which are no longer part of it, looking on
+// namespaces targeted by manifest. With all-namespaces, owned objects are searched cluster-wide, so
+// objects left behind when a group moves to another namespace are also pruned. Objects without
+// ownership labels are never touched.
+func (c *Copy) Prune(dryRun, allNamespaces bool) error {
+	var owned []ownedRef
+	var err error
+
+	targets := make(map[ownedRef]bool)
+	namespaces := make(map[string]bool)
+	for group := range c.manifest.Secrets {
+		for _, namespace := range c.namespaces(group) {
+			targets[ownedRef{kind: c.kind(group), namespace: namespace, name: group}] = true
+			namespaces[namespace] = true
+		}
 	}
-	logger.Info("Secrets are the same!")
 
+	selector := labels.SelectorFromSet(c.ownerLabels()).String()
+	logger := c.logger.WithField("selector", selector)
+
+	if allNamespaces {
+		logger.Info("Looking for secrets and config-maps to prune, on all namespaces")
+		if owned, err = c.owned(metav1.NamespaceAll, selector); err != nil {
+			return err
+		}
+	} else {
+		names := make([]string, 0, len(namespaces))
+		for namespace := range namespaces {
+			names = append(names, namespace)
+		}
+		sort.Strings(names)
+		for _, namespace := range names {
+			var found []ownedRef
+			logger.WithField("namespace", namespace).Info("Looking for secrets and config-maps to prune")
+			if found, err = c.owned(namespace, selector); err != nil {
+				return err
+			}
+			owned = append(owned, found...)
+		}
+	}
+	for _, ref := range owned {
+		if targets[ref] {
+			continue
+		}
+		if dryRun {
+			logger.Infof("[DRY-RUN] Kubernetes %s '%s/%s' would be pruned",
+				ref.kind, ref.namespace, ref.name)
+			continue
+		}
+		logger.Infof("Pruning Kubernetes %s '%s/%s'", ref.kind, ref.namespace, ref.name)
+		if ref.kind == ConfigMapKind {
+			err = c.kube.ConfigMapDelete(ref.namespace, ref.name)
+		} else {
+			err = c.kube.SecretDelete(ref.namespace, ref.name)
+		}
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
-// NewCopy creates a new Copy instance.
-func NewCopy(kube *Kubernetes, download *Download) *Copy {
+// owned secrets and config-maps in namespace, or all namespaces when empty, matching selector.
+func (c *Copy) owned(namespace, selector string) ([]ownedRef, error) {
+	var owned []ownedRef
+
+	secrets, err := c.kube.SecretList(namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, secret := range secrets {
+		owned = append(owned,
+			ownedRef{kind: SecretKind, namespace: secret.Namespace, name: secret.Name})
+	}
+
+	configMaps, err := c.kube.ConfigMapList(namespace, selector)
+	if err != nil {
+		return nil, err
+	}
+	for _, configMap := range configMaps {
+		owned = append(owned,
+			ownedRef{kind: ConfigMapKind, namespace: configMap.Namespace, name: configMap.Name})
+	}
+	return owned, nil
+}
+
+// SetOwner add a owner reference to secrets written, so they are garbage collected with owner.
+func (c *Copy) SetOwner(owner metav1.OwnerReference) {
+	c.owners = append(c.owners, owner)
+}
+
+// ownerLabels labels identifying secrets created by vault-handler for manifest.
+func (c *Copy) ownerLabels() map[string]string {
+	return map[string]string{ManagedByLabel: ManagedByValue, ManifestLabel: c.manifest.ID()}
+}
+
+// secretHash SHA-256 of secret type and data, with keys sorted.
+func secretHash(secretType string, data map[string][]byte) string {
+	var keys []string
+
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	_, _ = fmt.Fprintf(h, "%s\x00", secretType)
+	for _, key := range keys {
+		_, _ = fmt.Fprintf(h, "%s\x00%d\x00", key, len(data[key]))
+		_, _ = h.Write(data[key])
+	}
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(h.Sum(nil)))
+}
+
+// NewCopy creates a new Copy instance, namespace is the default for groups not informing it.
+func NewCopy(kube *Kubernetes, download *Download, manifest *Manifest, namespace string) *Copy {
 	return &Copy{
 		logger:     log.WithField("type", "copy"),
 		kube:       kube,
 		download:   download,
+		manifest:   manifest,
+		namespace:  namespace,
 		secretType: make(map[string]string),
-		data:       make(map[string]map[string][]byte),
+		meta:       make(map[secretRef]metav1.ObjectMeta),
+		data:       make(map[secretRef]map[string][]byte),
+		changed:    make(map[secretRef]bool),
 	}
 }
@@ -0,0 +1,230 @@
+package vaulthandler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+func TestCopyObjectMeta(t *testing.T) {
+	manifest := &Manifest{
+		File: "manifest.yaml",
+		Secrets: map[string]Secrets{"group": {
+			Path:        "kv/app",
+			Labels:      map[string]string{"team": "team"},
+			Annotations: map[string]string{"note": "note"},
+		}},
+	}
+	c := NewCopy(nil, nil, manifest, "default")
+
+	meta := c.objectMeta("group", &File{KVVersion: 2}, "hash")
+	assert.Equal(t, "group", meta.Name)
+	assert.Equal(t, map[string]string{
+		"team":         "team",
+		ManagedByLabel: ManagedByValue,
+		ManifestLabel:  manifest.ID(),
+	}, meta.Labels)
+	assert.Equal(t, map[string]string{
+		"note":                "note",
+		VaultPathAnnotation:   "kv/app",
+		KVVersionAnnotation:   "2",
+		ManifestAnnotation:    "manifest.yaml",
+		ContentHashAnnotation: "hash",
+	}, meta.Annotations)
+
+	// existing metadata from others is kept, and desired is applied
+	existing := meta
+	existing.Labels = map[string]string{"foreign": "label"}
+	existing.Annotations = nil
+	assert.False(t, hasObjectMeta(existing, meta))
+	mergeObjectMeta(&existing, meta)
+	assert.True(t, hasObjectMeta(existing, meta))
+	assert.Equal(t, "label", existing.Labels["foreign"])
+}
+
+func TestCopySecretHash(t *testing.T) {
+	data := map[string][]byte{"a": []byte("1"), "b": []byte("2")}
+	hash := secretHash("Opaque", data)
+
+	assert.Equal(t, hash, secretHash("Opaque", map[string][]byte{"b": []byte("2"), "a": []byte("1")}))
+	assert.NotEqual(t, hash, secretHash("kubernetes.io/tls", data))
+	assert.NotEqual(t, hash, secretHash("Opaque", map[string][]byte{"a": []byte("12")}))
+}
+
+func TestCopySetSecretType(t *testing.T) {
+	manifest := &Manifest{Secrets: map[string]Secrets{
+		"secret":    {},
+		"configmap": {Kind: ConfigMapKind},
+		"unknown":   {Kind: "Unknown"},
+	}}
+	c := NewCopy(nil, nil, manifest, "default")
+
+	assert.Nil(t, c.setSecretType("secret", &File{}))
+	assert.Equal(t, "Opaque", c.secretType["secret"])
+
+	assert.Nil(t, c.setSecretType("configmap", &File{}))
+	assert.Equal(t, ConfigMapKind, c.secretType["configmap"])
+	assert.NotNil(t, c.setSecretType("configmap", &File{SecretType: "kubernetes.io/tls"}))
+
+	assert.NotNil(t, c.setSecretType("unknown", &File{}))
+}
+
+func TestCopyRestartDryRun(t *testing.T) {
+	manifest := &Manifest{Secrets: map[string]Secrets{
+		"a": {Workloads: Workloads{Deployments: []string{"app"}}},
+		"b": {Workloads: Workloads{Deployments: []string{"app"}, DaemonSets: []string{"agent"}}},
+		"c": {},
+	}}
+	c := NewCopy(&Kubernetes{}, nil, manifest, "default")
+	for _, group := range []string{"a", "b", "c"} {
+		ref := secretRef{namespace: "default", name: group}
+		c.meta[ref] = c.objectMeta(group, &File{}, "hash")
+		c.changed[ref] = true
+	}
+
+	err := c.restart(true)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"default/DaemonSet/agent", "default/Deployment/app"}, c.Restarts)
+}
+
+// newFakeCopy copy of single file group "app" into "default" namespace, with a fake clientset
+// holding informed objects.
+func newFakeCopy(objects ...runtime.Object) (*Copy, []*File) {
+	manifest := &Manifest{File: "manifest.yaml", Secrets: map[string]Secrets{"app": {Path: "kv/app"}}}
+	files := []*File{NewFile("app", "", &SecretData{Name: "key"}, []byte("value"))}
+	k, _ := newFakeKubernetes(objects...)
+	c := NewCopy(k, &Download{Files: files}, manifest, kubeNamespace)
+	c.secretType["app"] = string(corev1.SecretTypeOpaque)
+	return c, files
+}
+
+func TestCopyCompareDrift(t *testing.T) {
+	ref := secretRef{namespace: kubeNamespace, name: "app"}
+	c, files := newFakeCopy()
+	desired := map[string][]byte{"key": []byte("value")}
+	meta := c.objectMeta("app", files[0], secretHash(string(corev1.SecretTypeOpaque), desired))
+	meta.Namespace = kubeNamespace
+
+	// up to date annotations and data
+	live := &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeOpaque, Data: desired}
+	c, _ = newFakeCopy(live)
+	assert.Nil(t, c.compare(kubeNamespace, "app", files))
+	assert.Len(t, c.data, 0)
+	assert.Len(t, c.Changes, 0)
+
+	// data changed in cluster, annotations untouched
+	live.Data = map[string][]byte{"key": []byte("tampered")}
+	c, _ = newFakeCopy(live)
+	assert.Nil(t, c.compare(kubeNamespace, "app", files))
+	assert.Equal(t, desired, c.data[ref])
+	assert.True(t, c.changed[ref])
+	assert.Len(t, c.Changes, 1)
+}
+
+func TestCopyCompareMetadataOutdated(t *testing.T) {
+	ref := secretRef{namespace: kubeNamespace, name: "app"}
+	c, files := newFakeCopy()
+	desired := map[string][]byte{"key": []byte("value")}
+	meta := c.objectMeta("app", files[0], secretHash(string(corev1.SecretTypeOpaque), desired))
+	meta.Namespace = kubeNamespace
+	delete(meta.Annotations, VaultPathAnnotation)
+
+	live := &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretTypeOpaque, Data: desired}
+	c, _ = newFakeCopy(live)
+	assert.Nil(t, c.compare(kubeNamespace, "app", files))
+	assert.Equal(t, desired, c.data[ref])
+	assert.False(t, c.changed[ref])
+	assert.Len(t, c.Changes, 0)
+}
+
+func TestCopyCompareTypeChanged(t *testing.T) {
+	ref := secretRef{namespace: kubeNamespace, name: "app"}
+	c, files := newFakeCopy()
+	desired := map[string][]byte{"key": []byte("value")}
+	meta := c.objectMeta("app", files[0], secretHash(string(corev1.SecretTypeOpaque), desired))
+	meta.Namespace = kubeNamespace
+
+	// same data, different type, restarts dependent workloads
+	live := &corev1.Secret{ObjectMeta: meta, Type: "example.com/other", Data: desired}
+	c, _ = newFakeCopy(live)
+	assert.Nil(t, c.compare(kubeNamespace, "app", files))
+	assert.True(t, c.changed[ref])
+	assert.Len(t, c.Changes, 0)
+}
+
+func TestCopyExecuteRestart(t *testing.T) {
+	deployment := &appsv1.Deployment{ObjectMeta: objectMeta(kubeNamespace, "web", nil)}
+	c, _ := newFakeCopy(deployment)
+	clientset := c.kube.clientset
+	workloads := Workloads{Deployments: []string{"web"}}
+	c.manifest.Secrets["app"] = Secrets{Path: "kv/app", Workloads: workloads}
+
+	// secret is created, and deployment restarted
+	assert.Nil(t, c.Prepare())
+	assert.Nil(t, c.Execute(false))
+	assert.Equal(t, []string{"default/Deployment/web"}, c.Restarts)
+
+	deployment, err := clientset.AppsV1().Deployments(kubeNamespace).Get("web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	secret, err := clientset.CoreV1().Secrets(kubeNamespace).Get("app", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, secret.Annotations[ContentHashAnnotation],
+		deployment.Spec.Template.Annotations[ChecksumAnnotationPrefix+"app"])
+
+	// unchanged secret does not restart deployment
+	again := NewCopy(c.kube, c.download, c.manifest, kubeNamespace)
+	assert.Nil(t, again.Prepare())
+	assert.Nil(t, again.Execute(false))
+	assert.Len(t, again.Restarts, 0)
+}
+
+func TestCopyPrune(t *testing.T) {
+	c, _ := newFakeCopy()
+	owner := c.ownerLabels()
+	other := map[string]string{ManagedByLabel: ManagedByValue, ManifestLabel: "other"}
+	objects := []runtime.Object{
+		&corev1.Secret{ObjectMeta: objectMeta(kubeNamespace, "app", owner)},
+		&corev1.Secret{ObjectMeta: objectMeta(kubeNamespace, "removed", owner)},
+		&corev1.ConfigMap{ObjectMeta: objectMeta(kubeNamespace, "removed", owner)},
+		&corev1.Secret{ObjectMeta: objectMeta(kubeNamespace, "unlabeled", nil)},
+		&corev1.Secret{ObjectMeta: objectMeta(kubeNamespace, "other", other)},
+		&corev1.Secret{ObjectMeta: objectMeta("moved", "app", owner)},
+		&corev1.ConfigMap{ObjectMeta: objectMeta("moved", "app", owner)},
+		&corev1.Secret{ObjectMeta: objectMeta("moved", "unlabeled", nil)},
+	}
+
+	names := func(c *Copy) []string {
+		var names []string
+		secrets, err := c.kube.SecretList(metav1.NamespaceAll, "")
+		assert.Nil(t, err)
+		for _, secret := range secrets {
+			names = append(names, secret.Namespace+"/"+secret.Name)
+		}
+		configMaps, err := c.kube.ConfigMapList(metav1.NamespaceAll, "")
+		assert.Nil(t, err)
+		for _, configMap := range configMaps {
+			names = append(names, "configmap/"+configMap.Namespace+"/"+configMap.Name)
+		}
+		return names
+	}
+
+	c, _ = newFakeCopy(objects...)
+	assert.Nil(t, c.Prune(true, true))
+	assert.Len(t, names(c), len(objects))
+
+	// by default only namespaces targeted by manifest are searched
+	assert.Nil(t, c.Prune(false, false))
+	assert.ElementsMatch(t, []string{
+		"default/app", "default/unlabeled", "default/other",
+		"moved/app", "configmap/moved/app", "moved/unlabeled",
+	}, names(c))
+
+	assert.Nil(t, c.Prune(false, true))
+	assert.ElementsMatch(t, []string{
+		"default/app", "default/unlabeled", "default/other", "moved/unlabeled",
+	}, names(c))
+}
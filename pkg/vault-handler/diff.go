@@ -0,0 +1,182 @@
+package vaulthandler
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// VaultDiffTarget compare files in input directory with Vault.
+	VaultDiffTarget = "vault"
+	// KubernetesDiffTarget compare Vault with Kubernetes secrets.
+	KubernetesDiffTarget = "kubernetes"
+)
+
+const (
+	// ChangeAdded entry is present on source, but not on target.
+	ChangeAdded = "added"
+	// ChangeRemoved entry is present on target, but not on source.
+	ChangeRemoved = "removed"
+	// ChangeChanged entry is present on both, with different contents.
+	ChangeChanged = "changed"
+)
+
+// Change on a single secret key, between source and target, carrying only content hashes.
+type Change struct {
+	Namespace  string // kubernetes namespace, when comparing with kubernetes
+	Group      string // manifest group name
+	Key        string // secret key name
+	Action     string // added, removed or changed
+	SourceHash string // content hash on source, empty when removed
+	TargetHash string // content hash on target, empty when added
+}
+
+// String representation of change, never showing values.
+func (c *Change) String() string {
+	name := fmt.Sprintf("%s/%s", c.Group, c.Key)
+	if c.Namespace != "" {
+		name = fmt.Sprintf("%s/%s", c.Namespace, name)
+	}
+
+	switch c.Action {
+	case ChangeAdded:
+		return fmt.Sprintf("+ %s (%s)", name, c.SourceHash)
+	case ChangeRemoved:
+		return fmt.Sprintf("- %s (%s)", name, c.TargetHash)
+	default:
+		return fmt.Sprintf("~ %s (%s -> %s)", name, c.TargetHash, c.SourceHash)
+	}
+}
+
+// Diff compares secrets described in manifest between files in input directory and Vault.
+type Diff struct {
+	logger   *log.Entry         // logger
+	vault    *Vault             // vault api instance
+	inputDir string             // input directory path
+	strategy string             // default upload strategy
+	files    map[string][]*File // local files per vault-path
+	removals map[string]bool    // report keys only found in vault, per vault-path
+	Changes  []*Change          // changes found
+}
+
+// Prepare by reading local files, organizing them per vault path.
+func (d *Diff) Prepare(logger *log.Entry, group string, secrets Secrets, data SecretData) error {
+	file := NewFile(group, secrets.Type, &data, []byte{})
+	if err := file.Load(d.inputDir); err != nil {
+		return err
+	}
+
+	vaultPath := d.vault.composePath(data, secrets.Path)
+	d.files[vaultPath] = append(d.files[vaultPath], file)
+
+	// keys not in manifest are only removed from vault by replace strategy
+	strategy := secrets.Strategy
+	if strategy == "" {
+		strategy = d.strategy
+	}
+	d.removals[vaultPath] = strategy == "" || strategy == ReplaceStrategy
+	return nil
+}
+
+// Compare local files with data stored in Vault, collecting changes.
+func (d *Diff) Compare() error {
+	var vaultPaths []string
+	var existing map[string]interface{}
+	var err error
+
+	for vaultPath := range d.files {
+		vaultPaths = append(vaultPaths, vaultPath)
+	}
+	sort.Strings(vaultPaths)
+
+	for _, vaultPath := range vaultPaths {
+		files := d.files[vaultPath]
+		logger := d.logger.WithField("vaultPath", vaultPath)
+		logger.Info("Comparing files with Vault")
+
+		if existing, err = d.vault.ReadData(vaultPath); err != nil {
+			return err
+		}
+
+		local := make(map[string][]byte)
+		remote := make(map[string][]byte)
+		for name, value := range existing {
+			payload, _ := value.(string)
+			remote[name] = []byte(payload)
+		}
+		for _, file := range files {
+			name := file.Properties.Name
+			local[name] = file.Payload
+			if payload, found := remote[name]; found && file.Properties.Zip {
+				zipped := NewFile(file.Group, file.SecretType, file.Properties, payload)
+				if err = zipped.Unzip(); err != nil {
+					logger.Warnf("Unable to unzip Vault payload of key '%s': '%s'", name, err)
+					continue
+				}
+				remote[name] = zipped.Payload
+			}
+		}
+
+		d.Changes = append(d.Changes, compareData(files[0].Group, local, remote, d.removals[vaultPath])...)
+	}
+	return nil
+}
+
+// compareData between source and target, returning changes sorted by key. Keys only present on
+// target are reported when removals is enabled.
+func compareData(group string, source, target map[string][]byte, removals bool) []*Change {
+	var changes []*Change
+
+	for key, payload := range source {
+		existing, found := target[key]
+		if !found {
+			changes = append(changes, &Change{
+				Group: group, Key: key, Action: ChangeAdded, SourceHash: contentHash(payload),
+			})
+			continue
+		}
+		if string(existing) != string(payload) {
+			changes = append(changes, &Change{
+				Group:      group,
+				Key:        key,
+				Action:     ChangeChanged,
+				SourceHash: contentHash(payload),
+				TargetHash: contentHash(existing),
+			})
+		}
+	}
+	if removals {
+		for key, existing := range target {
+			if _, found := source[key]; !found {
+				changes = append(changes, &Change{
+					Group: group, Key: key, Action: ChangeRemoved, TargetHash: contentHash(existing),
+				})
+			}
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	return changes
+}
+
+// contentHash short SHA-256 representation of payload, safe to display.
+func contentHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return fmt.Sprintf("sha256:%s", hex.EncodeToString(sum[:])[:16])
+}
+
+// NewDiff creates a new Diff instance.
+func NewDiff(vault *Vault, inputDir, strategy string) *Diff {
+	return &Diff{
+		logger:   log.WithField("type", "diff"),
+		vault:    vault,
+		inputDir: inputDir,
+		strategy: strategy,
+		files:    make(map[string][]*File),
+		removals: make(map[string]bool),
+	}
+}
@@ -0,0 +1,61 @@
+package vaulthandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffCompare(t *testing.T) {
+	m, v := newMockKV(t)
+	defer m.server.Close()
+
+	dir, err := ioutil.TempDir("", "vault-handler-diff")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	for name, payload := range map[string]string{"changed": "new", "same": "same", "added": "added"} {
+		err = ioutil.WriteFile(path.Join(dir, "group."+name+".txt"), []byte(payload), 0600)
+		assert.Nil(t, err)
+	}
+
+	m.secrets["app"] = []map[string]interface{}{
+		{"changed": "old", "same": "same", "foreign": "foreign"},
+	}
+	logger := log.WithField("test", "diff")
+
+	for _, strategy := range []string{ReplaceStrategy, MergeStrategy} {
+		d := NewDiff(v, dir, strategy)
+		for _, name := range []string{"changed", "same", "added"} {
+			err = d.Prepare(logger, "group", Secrets{Path: "kv/app"}, SecretData{Name: name, Extension: "txt"})
+			assert.Nil(t, err)
+		}
+
+		err = d.Compare()
+		assert.Nil(t, err)
+
+		var actions []string
+		for _, change := range d.Changes {
+			actions = append(actions, change.Key+":"+change.Action)
+			assert.NotContains(t, change.String(), "new")
+		}
+		if strategy == ReplaceStrategy {
+			assert.Equal(t, []string{"added:added", "changed:changed", "foreign:removed"}, actions)
+		} else {
+			assert.Equal(t, []string{"added:added", "changed:changed"}, actions)
+		}
+	}
+}
+
+func TestDiffCompareData(t *testing.T) {
+	changes := compareData("group", map[string][]byte{"key": []byte("value")}, map[string][]byte{}, true)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, ChangeAdded, changes[0].Action)
+	assert.Equal(t, "+ group/key ("+contentHash([]byte("value"))+")", changes[0].String())
+
+	changes = compareData("group", map[string][]byte{}, map[string][]byte{"key": []byte("value")}, false)
+	assert.Len(t, changes, 0)
+}
@@ -82,16 +82,16 @@ func (d *DotEnv) readExisting() error {
 // loadFiles loop over array of Files, load contents
 func (d *DotEnv) loadFiles() {
 	for _, file := range d.files {
-		k := d.envVarName(file)
+		k := envVarName("", file)
 		v := string(file.Payload)
 		d.logger.Tracef("Adding entry on dot-env: '%s'='%s'", k, v)
 		d.put(k, v)
 	}
 }
 
-// envVarName format a variable name based on a File instance.
-func (d *DotEnv) envVarName(file *File) string {
-	name := fmt.Sprintf("%s_%s_%s", file.Group, file.Properties.Name, file.Properties.Extension)
+// envVarName format a variable name based on a File instance, with optional prefix.
+func envVarName(prefix string, file *File) string {
+	name := fmt.Sprintf("%s%s_%s_%s", prefix, file.Group, file.Properties.Name, file.Properties.Extension)
 	return strings.ToUpper(name)
 }
 
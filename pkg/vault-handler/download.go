@@ -6,19 +6,22 @@ import (
 
 // Download represents the actions needed to download data from Vault, based in the manifest.
 type Download struct {
-	logger    *log.Entry // logger
-	vault     *Vault     // vault api instance
-	outputDir string     // output directory
-	Files     []*File    // list of downloaded files
+	logger       *log.Entry           // logger
+	vault        *Vault               // vault api instance
+	outputDir    string               // output directory
+	Files        []*File              // list of downloaded files
+	Certificates []*CertificateReport // certificates inspected, when enabled
 }
 
 // Prepare files by downloading them from vault, and keeping them aside for later write.
-func (d *Download) Prepare(logger *log.Entry, group, secretType, vaultPath string, data SecretData) error {
+func (d *Download) Prepare(logger *log.Entry, group string, secrets Secrets, data SecretData) error {
 	var keyName string
 	var payload []byte
+	var version int
+	var mount *kvMount
 	var err error
 
-	vaultPath = d.vault.composePath(data, vaultPath)
+	vaultPath := d.vault.composePath(data, secrets.Path)
 	logger = logger.WithField("vaultPath", vaultPath)
 
 	if data.Key != "" {
@@ -28,12 +31,19 @@ func (d *Download) Prepare(logger *log.Entry, group, secretType, vaultPath strin
 	}
 
 	logger.Infof("Reading data from Vault, key '%s'", keyName)
-	if payload, err = d.vault.Read(vaultPath, keyName); err != nil {
+	if payload, version, err = d.vault.ReadVersion(vaultPath, keyName, data.Version); err != nil {
 		return err
 	}
 
-	logger.Info("Creating a file instance")
-	file := NewFile(group, secretType, &data, payload)
+	if mount, err = d.vault.mount(vaultPath); err != nil {
+		return err
+	}
+
+	logger.WithField("readVersion", version).Info("Creating a file instance")
+	file := NewFile(group, secrets.Type, &data, payload)
+	file.Version = version
+	file.VaultPath = vaultPath
+	file.KVVersion = mount.version
 	if data.Zip {
 		if err = file.Unzip(); err != nil {
 			return err
@@ -59,6 +69,10 @@ func (d *Download) Execute(dryRun bool) error {
 			return err
 		}
 	}
+
+	d.logger.WithFields(log.Fields{"files": len(d.Files), "certificates": len(d.Certificates)}).
+		Info("Download summary")
+	logCertificates(d.logger, d.Certificates)
 	return nil
 }
 
@@ -0,0 +1,194 @@
+package vaulthandler
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"reflect"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	vaultapi "github.com/hashicorp/vault/api"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// execStopTimeout time given to child process to stop, before being killed.
+	execStopTimeout = 10 * time.Second
+	// configEnvPrefix prefix of vault-handler configuration variables, kept out of child process.
+	configEnvPrefix = "VAULT_HANDLER_"
+)
+
+// Exec runs a child process with downloaded secrets in its environment, forwarding signals and
+// exit code. Optionally the child is restarted when secrets change.
+type Exec struct {
+	logger   *log.Entry        // logger
+	command  []string          // command and arguments
+	prefix   string            // environment variable name prefix
+	interval time.Duration     // interval between checking secrets, zero disables restarts
+	jitter   time.Duration     // maximum random delay added to interval
+	secrets  map[string]string // secrets in child process environment
+	cmd      *exec.Cmd         // child process
+	exited   chan error        // receives child process wait result
+}
+
+// Run fetch secrets and start child process, waiting until it exits. Signals received are forwarded
+// to child process, and when interval is set, child is restarted after secrets change. Returns child
+// process exit code.
+func (e *Exec) Run(fetch fetchFiles, signals <-chan os.Signal) (int, error) {
+	var files []*File
+	var err error
+
+	if files, err = fetch(); err != nil {
+		return 1, err
+	}
+	if err = e.start(files); err != nil {
+		return 1, err
+	}
+
+	for {
+		var tick <-chan time.Time
+		if e.interval > 0 {
+			tick = time.After(jitterDelay(e.interval, e.jitter))
+		}
+
+		select {
+		case signal := <-signals:
+			e.logger.Infof("Forwarding signal '%s' to child process", signal)
+			if err = e.cmd.Process.Signal(signal); err != nil {
+				e.logger.Errorf("On forwarding signal: '%s'", err)
+			}
+		case err = <-e.exited:
+			return exitCode(err)
+		case <-tick:
+			if files, err = fetch(); err != nil {
+				e.logger.Errorf("On fetching secrets: '%s'", err)
+				continue
+			}
+			if reflect.DeepEqual(e.secrets, e.secretsEnv(files)) {
+				e.logger.Debug("Secrets are not changed")
+				continue
+			}
+			e.logger.Info("Secrets have changed, restarting child process")
+			if err = e.stop(); err != nil {
+				return 1, err
+			}
+			if err = e.start(files); err != nil {
+				return 1, err
+			}
+		}
+	}
+}
+
+// start child process with secrets in environment.
+func (e *Exec) start(files []*File) error {
+	e.secrets = e.secretsEnv(files)
+	e.cmd = exec.Command(e.command[0], e.command[1:]...)
+	e.cmd.Env = e.environ()
+	e.cmd.Stdin = os.Stdin
+	e.cmd.Stdout = os.Stdout
+	e.cmd.Stderr = os.Stderr
+
+	e.logger.Infof("Starting child process '%s' with '%d' secrets", e.command[0], len(e.secrets))
+	if err := e.cmd.Start(); err != nil {
+		return err
+	}
+
+	exited := make(chan error, 1)
+	go func(cmd *exec.Cmd) { exited <- cmd.Wait() }(e.cmd)
+	e.exited = exited
+	return nil
+}
+
+// stop child process gracefully, killing it after timeout.
+func (e *Exec) stop() error {
+	e.logger.Info("Stopping child process")
+	if err := e.cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return err
+	}
+	select {
+	case <-e.exited:
+		return nil
+	case <-time.After(execStopTimeout):
+		e.logger.Warn("Child process did not stop in time, killing it")
+		if err := e.cmd.Process.Kill(); err != nil {
+			return err
+		}
+		<-e.exited
+		return nil
+	}
+}
+
+// secretsEnv environment variables representing the files.
+func (e *Exec) secretsEnv(files []*File) map[string]string {
+	secrets := make(map[string]string)
+	for _, file := range files {
+		name := envVarName(e.prefix, file)
+		if _, found := secrets[name]; found {
+			e.logger.Warnf("Environment variable '%s' is being overwritten!", name)
+		}
+		e.logger.Tracef("Adding environment variable '%s'", name)
+		secrets[name] = string(file.Payload)
+	}
+	return secrets
+}
+
+// environ current environment, without vault-handler own configuration and credentials, overwritten
+// by secrets.
+func (e *Exec) environ() []string {
+	var env []string
+	var names []string
+
+	for _, variable := range os.Environ() {
+		// vault api client reads token from environment too, it's not handed over either
+		if strings.HasPrefix(variable, configEnvPrefix) ||
+			strings.HasPrefix(variable, vaultapi.EnvVaultToken+"=") {
+			continue
+		}
+		env = append(env, variable)
+	}
+	for name := range e.secrets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		env = append(env, fmt.Sprintf("%s=%s", name, e.secrets[name]))
+	}
+	return env
+}
+
+// exitCode extract exit code from child process wait result, signaled processes follow the shell
+// convention of 128 plus signal number.
+func exitCode(err error) (int, error) {
+	if err == nil {
+		return 0, nil
+	}
+	exitErr, ok := err.(*exec.ExitError)
+	if !ok {
+		return 1, err
+	}
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	if !ok {
+		return 1, err
+	}
+	if status.Signaled() {
+		return 128 + int(status.Signal()), nil
+	}
+	return status.ExitStatus(), nil
+}
+
+// NewExec creates a new Exec instance, interval zero disables restarts.
+func NewExec(command []string, prefix string, interval, jitter time.Duration) (*Exec, error) {
+	if len(command) == 0 {
+		return nil, fmt.Errorf("command is not informed")
+	}
+	return &Exec{
+		logger:   log.WithFields(log.Fields{"type": "exec", "command": command[0]}),
+		command:  command,
+		prefix:   prefix,
+		interval: interval,
+		jitter:   jitter,
+	}, nil
+}
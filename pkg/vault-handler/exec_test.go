@@ -0,0 +1,94 @@
+package vaulthandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecRun(t *testing.T) {
+	fetch := func() ([]*File, error) {
+		return []*File{
+			NewFile("group", "", &SecretData{Name: "key", Extension: "txt"}, []byte("secret")),
+		}, nil
+	}
+
+	e, err := NewExec([]string{"sh", "-c", `test "$APP_GROUP_KEY_TXT" = secret && exit 3`}, "app_", 0, 0)
+	assert.Nil(t, err)
+
+	code, err := e.Run(fetch, make(chan os.Signal))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, code)
+
+	_, err = NewExec([]string{}, "", 0, 0)
+	assert.NotNil(t, err)
+}
+
+func TestExecEnviron(t *testing.T) {
+	names := []string{"VAULT_HANDLER_VAULT_TOKEN", "VAULT_HANDLER_VAULT_SECRET_ID", "VAULT_TOKEN"}
+	for _, name := range names {
+		os.Setenv(name, "credential")
+		defer os.Unsetenv(name)
+	}
+
+	e, err := NewExec([]string{"env"}, "", 0, 0)
+	assert.Nil(t, err)
+	e.secrets = map[string]string{"GROUP_KEY_TXT": "secret"}
+
+	env := e.environ()
+	assert.Contains(t, env, "GROUP_KEY_TXT=secret")
+	for _, variable := range env {
+		assert.False(t, strings.HasPrefix(variable, "VAULT_HANDLER_"), variable)
+		assert.False(t, strings.HasPrefix(variable, "VAULT_TOKEN="), variable)
+	}
+}
+
+func TestExecRunRestart(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-handler-exec")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	output := path.Join(dir, "output")
+
+	var iteration int
+	fetch := func() ([]*File, error) {
+		iteration++
+		payload := "first"
+		if iteration > 1 {
+			payload = "second"
+		}
+		return []*File{
+			NewFile("group", "", &SecretData{Name: "key", Extension: "txt"}, []byte(payload)),
+		}, nil
+	}
+
+	command := []string{"sh", "-c", `echo $GROUP_KEY_TXT >> ` + output + ` && exec sleep 5`}
+	e, err := NewExec(command, "", 10*time.Millisecond, 0)
+	assert.Nil(t, err)
+
+	signals := make(chan os.Signal, 1)
+	go func() {
+		// waiting for the restart to happen, and then stopping child process
+		for {
+			written, _ := ioutil.ReadFile(output)
+			if strings.Count(string(written), "\n") >= 2 {
+				signals <- syscall.SIGTERM
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+
+	code, err := e.Run(fetch, signals)
+	assert.Nil(t, err)
+	assert.Equal(t, 128+int(syscall.SIGTERM), code)
+
+	written, err := ioutil.ReadFile(output)
+	assert.Nil(t, err)
+	assert.Equal(t, "first\nsecond\n", string(written))
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"io"
 	"io/ioutil"
+	"os"
 	"path"
 
 	log "github.com/sirupsen/logrus"
@@ -19,6 +20,9 @@ type File struct {
 	SecretType string      // secret file type (for kubernetes)
 	Properties *SecretData // using SecretData as file properties
 	Payload    []byte      // data payload
+	Version    int         // secret version read from vault, on kv-v2
+	VaultPath  string      // vault path the payload was read from
+	KVVersion  int         // key-value secrets engine version of vault path
 }
 
 // Zip file payload with gzip.
@@ -87,14 +91,31 @@ func (f *File) Read(baseDir string) error {
 	return nil
 }
 
-// Write contents to file-system.
+// Load payload from environment variable, when informed on properties, or from file-system.
+func (f *File) Load(baseDir string) error {
+	if f.Properties.FromEnv == "" {
+		f.logger.Info("Reading payload from file-system.")
+		return f.Read(baseDir)
+	}
+
+	f.logger.Infof("Reading payload from environment-variable '%s'", f.Properties.FromEnv)
+	payload := os.Getenv(f.Properties.FromEnv)
+	if payload == "" {
+		return fmt.Errorf("can't find environment variable '%s'", f.Properties.FromEnv)
+	}
+	f.Payload = []byte(payload)
+	return nil
+}
+
+// Write contents to file-system, atomically.
 func (f *File) Write(baseDir string) error {
 	f.logger.WithFields(log.Fields{
 		"name":    f.fileName(),
 		"bytes":   len(f.Payload),
 		"baseDir": baseDir,
 	}).Info("Writing file content")
-	return ioutil.WriteFile(f.FilePath(baseDir), f.Payload, 0600)
+
+	return writeAtomic(baseDir, f.fileName(), f.Payload)
 }
 
 // fileName compose file name based on group and SecretData settings.
@@ -1,7 +1,12 @@
 package vaulthandler
 
 import (
+	"io"
+	"os"
+	"time"
+
 	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/dynamic"
 )
 
 // Handler application primary runtime object.
@@ -11,32 +16,40 @@ type Handler struct {
 	vault  *Vault     // vault api instance
 }
 
-// actOnSecret method that will receive a secret entry in a group, where vault-path is also shared.
-type actOnSecret func(logger *log.Entry, group, secretType, vaultPath string, data SecretData) error
+// actOnSecret method that will receive a secret entry in a group, alongside group's definition.
+type actOnSecret func(logger *log.Entry, group string, secrets Secrets, data SecretData) error
 
-// Authenticate against vault either via token directly or via AppRole, must be invoked before other
-// actions using the API.
+// Authenticate against vault using the configured authentication method, must be invoked before
+// other actions using the API.
 func (h *Handler) Authenticate() error {
-	var err error
+	method, err := h.cfg.AuthMethod()
+	if err != nil {
+		return err
+	}
 
-	if h.cfg.VaultToken != "" {
-		h.logger.Info("Using token based authentication")
-		h.vault.TokenAuth(h.cfg.VaultToken)
-	} else {
-		h.logger.Info("Using AppRole based authentication")
-		if err = h.vault.AppRoleAuth(h.cfg.VaultRoleID, h.cfg.VaultSecretID); err != nil {
-			return err
-		}
+	h.logger.Infof("Using '%s' authentication method", method.Name())
+	if err = method.Login(h.vault, withDefaults(method, h.cfg.VaultAuthOptions)); err != nil {
+		return err
 	}
+	return h.vault.StartRenewal()
+}
 
-	return nil
+// Close stop token renewal and revoke the token obtained during authentication, unless configured to
+// keep the token.
+func (h *Handler) Close() error {
+	if h.cfg.VaultKeepToken {
+		h.logger.Info("Keeping Vault token, not revoking it")
+		h.vault.StopRenewal()
+		return nil
+	}
+	return h.vault.Revoke()
 }
 
 // Upload files to Vault, accordingly to the manifest.
 func (h *Handler) Upload(manifest *Manifest) error {
 	var err error
 
-	u := NewUpload(h.vault, h.cfg.InputDir)
+	u := NewUpload(h.vault, h.cfg.InputDir, h.cfg.CAS, h.cfg.Strategy)
 	if err = h.loop(h.logger.WithField("action", "upload"), manifest, u.Prepare); err != nil {
 		return err
 	}
@@ -52,9 +65,19 @@ func (h *Handler) Download(manifest *Manifest) error {
 	if err = h.loop(h.logger.WithField("action", "download"), manifest, d.Prepare); err != nil {
 		return err
 	}
+	if d.Certificates, err = h.inspect(d.Files); err != nil {
+		return err
+	}
+	t := NewTemplates(manifest, h.cfg.OutputDir)
+	if err = t.Prepare(d.Files); err != nil {
+		return err
+	}
 	if err = d.Execute(h.cfg.DryRun); err != nil {
 		return err
 	}
+	if err = t.Execute(h.cfg.DryRun); err != nil {
+		return err
+	}
 
 	if !h.cfg.DotEnv {
 		return nil
@@ -68,35 +91,180 @@ func (h *Handler) Download(manifest *Manifest) error {
 	return dotEnv.Write(h.cfg.DryRun)
 }
 
+// Watch download secrets from manifests periodically, rewriting only files and templates that
+// changed, until stop channel is closed.
+func (h *Handler) Watch(manifests []*Manifest, stop <-chan struct{}) error {
+	logger := h.logger.WithField("action", "watch")
+	w := NewWatch(
+		manifests, h.cfg.OutputDir, h.cfg.WatchInterval, h.cfg.WatchJitter, h.cfg.DryRun, h.cfg.reload(),
+	)
+	return w.Run(h.fetch(logger, manifests), stop)
+}
+
+// Exec download secrets from manifests and run command with secrets in environment, forwarding
+// signals to it. Returns the command exit code. Templates are ignored, since nothing is written to
+// the file-system.
+func (h *Handler) Exec(manifests []*Manifest, command []string, signals <-chan os.Signal) (int, error) {
+	var e *Exec
+	var err error
+
+	logger := h.logger.WithField("action", "exec")
+	for _, manifest := range manifests {
+		if len(manifest.Templates) > 0 {
+			logger.WithField("manifest", manifest.File).
+				Warn("Templates are not rendered by exec, ignoring")
+		}
+	}
+
+	var interval time.Duration
+	if h.cfg.ExecRestart {
+		interval = h.cfg.WatchInterval
+	}
+	if e, err = NewExec(command, h.cfg.ExecPrefix, interval, h.cfg.WatchJitter); err != nil {
+		return 1, err
+	}
+	return e.Run(h.fetch(logger, manifests), signals)
+}
+
+// fetch returns a function to download secrets from manifests, without writing them.
+func (h *Handler) fetch(logger *log.Entry, manifests []*Manifest) fetchFiles {
+	return func() ([]*File, error) {
+		d := NewDownload(h.vault, h.cfg.OutputDir)
+		for _, manifest := range manifests {
+			if err := h.loop(logger, manifest, d.Prepare); err != nil {
+				return nil, err
+			}
+		}
+		return d.Files, nil
+	}
+}
+
 // Copy secrets from Vault into Kubernetes.
 func (h *Handler) Copy(manifest *Manifest) error {
+	var c *Copy
+	var err error
+
+	if c, err = h.prepareCopy(h.logger.WithField("action", "copy"), manifest); err != nil {
+		return err
+	}
+	if err = c.Execute(h.cfg.DryRun); err != nil {
+		return err
+	}
+	if !h.cfg.Prune {
+		return nil
+	}
+	return c.Prune(h.cfg.DryRun, h.cfg.PruneAll)
+}
+
+// Render Kubernetes objects for secrets in manifest, on output directory or writer, without using
+// Kubernetes API.
+func (h *Handler) Render(manifest *Manifest, out io.Writer) error {
+	var err error
+
+	if err = manifest.ValidateKubernetes(); err != nil {
+		return err
+	}
+	d := NewDownload(h.vault, "")
+	if err = h.loop(h.logger.WithField("action", "render"), manifest, d.Prepare); err != nil {
+		return err
+	}
+
+	r := NewRender(d, manifest, h.cfg.Namespace, h.cfg.RenderFormat, h.cfg.OutputDir, out)
+	if err = r.Prepare(); err != nil {
+		return err
+	}
+	return r.Execute(h.cfg.DryRun)
+}
+
+// RunController reconcile VaultSecret custom resources into Kubernetes secrets, until stop channel
+// is closed. Watches configured namespace, or all namespaces when empty.
+func (h *Handler) RunController(stop <-chan struct{}) error {
 	var k *Kubernetes
+	var client dynamic.Interface
 	var err error
 
-	if k, err = NewKubernetes(
-		h.cfg.KubeConfig, h.cfg.Context, h.cfg.Namespace, h.cfg.InCluster,
-	); err != nil {
+	if k, err = NewKubernetes(h.cfg.KubeConfig, h.cfg.Context, h.cfg.InCluster); err != nil {
+		return err
+	}
+	if client, err = k.Dynamic(); err != nil {
 		return err
 	}
+	return NewController(h, k, client, h.cfg.Namespace, h.cfg.WatchInterval).Run(stop)
+}
+
+// Diff compare secrets in manifest, between input directory and Vault, or between Vault and
+// Kubernetes, depending on configured target. Changes carry only key names and content hashes.
+func (h *Handler) Diff(manifest *Manifest) ([]*Change, error) {
+	var err error
+
+	logger := h.logger.WithField("action", "diff")
+	if h.cfg.DiffTarget == KubernetesDiffTarget {
+		var c *Copy
+		if c, err = h.prepareCopy(logger, manifest); err != nil {
+			return nil, err
+		}
+		return c.Changes, nil
+	}
+
+	d := NewDiff(h.vault, h.cfg.InputDir, h.cfg.Strategy)
+	if err = h.loop(logger, manifest, d.Prepare); err != nil {
+		return nil, err
+	}
+	if err = d.Compare(); err != nil {
+		return nil, err
+	}
+	return d.Changes, nil
+}
+
+// prepareCopy download secrets from Vault and compare them with Kubernetes, without writing.
+func (h *Handler) prepareCopy(logger *log.Entry, manifest *Manifest) (*Copy, error) {
+	var k *Kubernetes
+	var err error
+
+	if err = manifest.ValidateKubernetes(); err != nil {
+		return nil, err
+	}
+	if k, err = NewKubernetes(h.cfg.KubeConfig, h.cfg.Context, h.cfg.InCluster); err != nil {
+		return nil, err
+	}
 
 	// downloading data using regular approach
 	d := NewDownload(h.vault, "")
-	if err = h.loop(h.logger.WithField("action", "copy"), manifest, d.Prepare); err != nil {
-		return err
+	if err = h.loop(logger, manifest, d.Prepare); err != nil {
+		return nil, err
+	}
+	if d.Certificates, err = h.inspect(d.Files); err != nil {
+		return nil, err
 	}
 
 	// preparing copy of downloaded data to kubernetes
-	c := NewCopy(k, d)
+	c := NewCopy(k, d, manifest, h.cfg.Namespace)
 	if err = c.Prepare(); err != nil {
-		return err
+		return nil, err
 	}
-	return c.Execute(h.cfg.DryRun)
+	return c, nil
+}
+
+// inspect certificates and keys in downloaded files, when enabled, before they are written. Returns
+// the certificate reports.
+func (h *Handler) inspect(files []*File) ([]*CertificateReport, error) {
+	if !h.cfg.CertInspect {
+		return nil, nil
+	}
+	i := NewInspection(h.cfg.CertMinValidity, h.cfg.CertWarnOnly)
+	if err := i.Check(files); err != nil {
+		return nil, err
+	}
+	return i.Reports, nil
 }
 
 // loop execute the primary manifest item loop, yielding informed method.
 func (h *Handler) loop(logger *log.Entry, manifest *Manifest, fn actOnSecret) error {
 	for group, secrets := range manifest.Secrets {
 		for _, data := range secrets.Data {
+			if data.Version == 0 {
+				data.Version = secrets.Version
+			}
 			logger = logger.WithFields(log.Fields{
 				"name":       data.Name,
 				"extension":  data.Extension,
@@ -104,8 +272,9 @@ func (h *Handler) loop(logger *log.Entry, manifest *Manifest, fn actOnSecret) er
 				"group":      group,
 				"vaultPath":  secrets.Path,
 				"secretType": secrets.Type,
+				"version":    data.Version,
 			})
-			if err := fn(logger, group, secrets.Type, secrets.Path, data); err != nil {
+			if err := fn(logger, group, secrets, data); err != nil {
 				return err
 			}
 		}
@@ -34,8 +34,8 @@ func TestHandlerAuthenticateToken(t *testing.T) {
 	log.SetLevel(log.TraceLevel)
 
 	config := &Config{
-		VaultAddr:  vaultAddr,
-		VaultToken: vaultRootToken,
+		VaultAddr:        vaultAddr,
+		VaultAuthOptions: AuthOptions{"vault-token": vaultRootToken},
 	}
 
 	h, err := NewHandler(config)
@@ -49,13 +49,15 @@ func TestHandlerAuthenticateAppRole(t *testing.T) {
 	var err error
 
 	config := &Config{
-		VaultAddr:     vaultAddr,
-		VaultRoleID:   os.Getenv("VAULT_HANDLER_VAULT_ROLE_ID"),
-		VaultSecretID: os.Getenv("VAULT_HANDLER_VAULT_SECRET_ID"),
-		InputDir:      inputDir,
-		OutputDir:     outputDir,
-		KubeConfig:    os.Getenv("KUBECONFIG"),
-		Namespace:     "default",
+		VaultAddr: vaultAddr,
+		VaultAuthOptions: AuthOptions{
+			"vault-role-id":   os.Getenv("VAULT_HANDLER_VAULT_ROLE_ID"),
+			"vault-secret-id": os.Getenv("VAULT_HANDLER_VAULT_SECRET_ID"),
+		},
+		InputDir:   inputDir,
+		OutputDir:  outputDir,
+		KubeConfig: os.Getenv("KUBECONFIG"),
+		Namespace:  "default",
 	}
 	err = config.Validate()
 	assert.Nil(t, err)
@@ -116,3 +118,13 @@ func TestHandlerCopy(t *testing.T) {
 	err := handler.Copy(handlerManifest)
 	assert.Nil(t, err)
 }
+
+func TestHandlerExecTemplates(t *testing.T) {
+	manifest := &Manifest{Templates: []Template{{Source: "app.conf.tmpl", Target: "app.conf"}}}
+
+	// templates are ignored, command still runs
+	h := &Handler{cfg: &Config{}, logger: log.WithField("type", "Handler")}
+	code, err := h.Exec([]*Manifest{manifest}, []string{"sh", "-c", "exit 3"}, make(chan os.Signal))
+	assert.Nil(t, err)
+	assert.Equal(t, 3, code)
+}
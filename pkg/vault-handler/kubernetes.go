@@ -5,83 +5,162 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"unicode/utf8"
 
 	log "github.com/sirupsen/logrus"
 	corev1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth/gcp" // making sure gcp plugin is present
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/util/retry"
 )
 
 // Kubernetes api client instance
 type Kubernetes struct {
-	logger     *log.Entry            // logger
-	clientset  *kubernetes.Clientset // kubernetes api client
-	kubeConfig string                // kube-config path
-	context    string                // kubernetes context
-	namespace  string                // kubernetes namespace
+	logger     *log.Entry           // logger
+	clientset  kubernetes.Interface // kubernetes api client
+	config     *rest.Config         // kubernetes api client configuration
+	kubeConfig string               // kube-config path
+	context    string               // kubernetes context
 }
 
-// SecretWrite write a secret to kubernetes, based in a secret type and map with data.
-func (k *Kubernetes) SecretWrite(name, secretType string, data map[string][]byte) error {
-	var exists bool
+// SecretWrite write a secret to kubernetes, based in object metadata, secret type and map with data.
+// Existing secrets are updated in place, merging labels and annotations, and keeping metadata added
+// by others, retrying on conflicts. Secrets are only recreated when type changes, since it's
+// immutable. Namespace is created when not found.
+func (k *Kubernetes) SecretWrite(
+	namespace string, meta metav1.ObjectMeta, secretType string, data map[string][]byte,
+) error {
 	var err error
 
-	if exists, err = k.SecretExists(name); err != nil {
+	if secretType == "" {
+		secretType = string(corev1.SecretTypeOpaque)
+	}
+	if err = k.createNamespace(namespace); err != nil {
 		return err
 	}
-	if exists {
-		if err = k.SecretDelete(name); err != nil {
+
+	secrets := k.clientset.CoreV1().Secrets(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var secret *corev1.Secret
+		var err error
+
+		if secret, err = k.SecretGet(namespace, meta.Name); err != nil {
 			return err
 		}
+		if secret == nil {
+			k.logger.Infof("Creating secret '%s/%s'", namespace, meta.Name)
+			secret = &corev1.Secret{ObjectMeta: meta, Type: corev1.SecretType(secretType), Data: data}
+			_, err = secrets.Create(secret)
+			return err
+		}
+
+		mergeObjectMeta(&secret.ObjectMeta, meta)
+		if string(secret.Type) != secretType {
+			k.logger.Warnf("Secret '%s/%s' type changes from '%s' to '%s', recreating it",
+				namespace, meta.Name, secret.Type, secretType)
+			return k.secretRecreate(secret, secretType, data)
+		}
+
+		k.logger.Infof("Updating secret '%s/%s'", namespace, meta.Name)
+		secret.Data = data
+		_, err = secrets.Update(secret)
+		return err
+	})
+}
+
+// secretRecreate delete and create secret with a different type, keeping existing metadata. Once
+// deleted, creation is retried with backoff, and failing that the error informs the secret is gone.
+func (k *Kubernetes) secretRecreate(
+	existing *corev1.Secret, secretType string, data map[string][]byte,
+) error {
+	var err error
+
+	// making sure the deleted secret is the one that was read
+	uid := existing.UID
+	opts := &metav1.DeleteOptions{Preconditions: &metav1.Preconditions{UID: &uid}}
+	if err = k.clientset.CoreV1().Secrets(existing.Namespace).Delete(existing.Name, opts); err != nil {
+		return err
 	}
 
 	secret := &corev1.Secret{
-		ObjectMeta: metav1.ObjectMeta{Name: name},
-		Type:       corev1.SecretType(secretType),
-		Data:       data,
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            existing.Name,
+			Labels:          existing.Labels,
+			Annotations:     existing.Annotations,
+			OwnerReferences: existing.OwnerReferences,
+		},
+		Type: corev1.SecretType(secretType),
+		Data: data,
 	}
-	if _, err = k.clientset.CoreV1().Secrets(k.namespace).Create(secret); err != nil {
-		return err
+	// secret is gone at this point, so creation is retried on any error but already-exists
+	var createErr error
+	err = wait.ExponentialBackoff(retry.DefaultBackoff, func() (bool, error) {
+		_, createErr = k.clientset.CoreV1().Secrets(existing.Namespace).Create(secret)
+		if createErr == nil || errors.IsAlreadyExists(createErr) {
+			return true, createErr
+		}
+		k.logger.Warnf("Creating secret '%s/%s' again: '%s'",
+			existing.Namespace, existing.Name, createErr)
+		return false, nil
+	})
+	if err == wait.ErrWaitTimeout {
+		return fmt.Errorf("secret '%s/%s' was deleted to change its type, but creating it failed: %s",
+			existing.Namespace, existing.Name, createErr)
 	}
-	return nil
+	return err
+}
+
+// SecretGet reads a secret object from Kubernetes, returns nil when not found.
+func (k *Kubernetes) SecretGet(namespace, name string) (*corev1.Secret, error) {
+	secret, err := k.clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return secret, nil
 }
 
 // SecretRead reads a secret from Kubernetes, returns a map with it's contents key-value style.
-func (k *Kubernetes) SecretRead(name string) (map[string][]byte, error) {
+func (k *Kubernetes) SecretRead(namespace, name string) (map[string][]byte, error) {
 	var secret *corev1.Secret
 	var err error
 
-	getOpts := metav1.GetOptions{}
-	data := make(map[string][]byte)
-
-	k.logger.Infof("Kubernetes, reading secret '%s'", name)
-	if secret, err = k.clientset.CoreV1().Secrets(k.namespace).Get(name, getOpts); err != nil {
+	k.logger.Infof("Kubernetes, reading secret '%s/%s'", namespace, name)
+	if secret, err = k.clientset.CoreV1().Secrets(namespace).Get(name, metav1.GetOptions{}); err != nil {
 		return nil, err
 	}
+	return k.secretData(secret), nil
+}
 
+// secretData extract data from secret, in the same way than it's read from Vault.
+func (k *Kubernetes) secretData(secret *corev1.Secret) map[string][]byte {
+	data := make(map[string][]byte)
 	for filename, byteArray := range secret.Data {
 		// executing the same treatment than in vault
 		byteArray = bytes.TrimRight(byteArray, "\n")
 		k.logger.Infof("Kubernetes-Secret: '%s' ('%d' bytes)", filename, len(byteArray))
 		data[filename] = byteArray
 	}
-
-	return data, nil
+	return data
 }
 
 // SecretExists check if a given secret exists.
-func (k *Kubernetes) SecretExists(name string) (bool, error) {
+func (k *Kubernetes) SecretExists(namespace, name string) (bool, error) {
 	var secretList *corev1.SecretList
 	var err error
 
 	listOpts := metav1.ListOptions{}
 
 	k.logger.Infof("Checking if secret '%s' exists...", name)
-	if secretList, err = k.clientset.CoreV1().Secrets(k.namespace).List(listOpts); err != nil {
+	if secretList, err = k.clientset.CoreV1().Secrets(namespace).List(listOpts); err != nil {
 		return false, err
 	}
 
@@ -96,9 +175,164 @@ func (k *Kubernetes) SecretExists(name string) (bool, error) {
 	return false, nil
 }
 
+// SecretList list secrets matching label selector.
+func (k *Kubernetes) SecretList(namespace, selector string) ([]corev1.Secret, error) {
+	secretList, err := k.clientset.CoreV1().Secrets(namespace).List(
+		metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return secretList.Items, nil
+}
+
 // SecretDelete deletes a secret.
-func (k *Kubernetes) SecretDelete(name string) error {
-	return k.clientset.CoreV1().Secrets(k.namespace).Delete(name, &metav1.DeleteOptions{})
+func (k *Kubernetes) SecretDelete(namespace, name string) error {
+	return k.clientset.CoreV1().Secrets(namespace).Delete(name, &metav1.DeleteOptions{})
+}
+
+// ConfigMapWrite write a config-map to kubernetes, based in object metadata and map with data. Data
+// is stored as string when valid UTF-8, and as binary otherwise. Existing config-maps are updated in
+// place, the same way than secrets. Namespace is created when not found.
+func (k *Kubernetes) ConfigMapWrite(namespace string, meta metav1.ObjectMeta, data map[string][]byte) error {
+	var err error
+
+	if err = k.createNamespace(namespace); err != nil {
+		return err
+	}
+
+	configMaps := k.clientset.CoreV1().ConfigMaps(namespace)
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		var configMap *corev1.ConfigMap
+		var err error
+
+		if configMap, err = k.ConfigMapGet(namespace, meta.Name); err != nil {
+			return err
+		}
+		if configMap == nil {
+			k.logger.Infof("Creating config-map '%s/%s'", namespace, meta.Name)
+			configMap = &corev1.ConfigMap{ObjectMeta: meta}
+			setConfigMapData(configMap, data)
+			_, err = configMaps.Create(configMap)
+			return err
+		}
+
+		k.logger.Infof("Updating config-map '%s/%s'", namespace, meta.Name)
+		mergeObjectMeta(&configMap.ObjectMeta, meta)
+		setConfigMapData(configMap, data)
+		_, err = configMaps.Update(configMap)
+		return err
+	})
+}
+
+// ConfigMapGet reads a config-map object from Kubernetes, returns nil when not found.
+func (k *Kubernetes) ConfigMapGet(namespace, name string) (*corev1.ConfigMap, error) {
+	configMap, err := k.clientset.CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return configMap, nil
+}
+
+// configMapData extract string and binary data from config-map, in the same way than secrets.
+func (k *Kubernetes) configMapData(configMap *corev1.ConfigMap) map[string][]byte {
+	data := make(map[string][]byte)
+	for filename, value := range configMap.Data {
+		data[filename] = bytes.TrimRight([]byte(value), "\n")
+	}
+	for filename, byteArray := range configMap.BinaryData {
+		data[filename] = bytes.TrimRight(byteArray, "\n")
+	}
+	for filename, byteArray := range data {
+		k.logger.Infof("Kubernetes-ConfigMap: '%s' ('%d' bytes)", filename, len(byteArray))
+	}
+	return data
+}
+
+// ConfigMapList list config-maps matching label selector.
+func (k *Kubernetes) ConfigMapList(namespace, selector string) ([]corev1.ConfigMap, error) {
+	configMapList, err := k.clientset.CoreV1().ConfigMaps(namespace).List(
+		metav1.ListOptions{LabelSelector: selector})
+	if err != nil {
+		return nil, err
+	}
+	return configMapList.Items, nil
+}
+
+// ConfigMapDelete deletes a config-map.
+func (k *Kubernetes) ConfigMapDelete(namespace, name string) error {
+	return k.clientset.CoreV1().ConfigMaps(namespace).Delete(name, &metav1.DeleteOptions{})
+}
+
+// setConfigMapData replace config-map data, using string data for valid UTF-8 and binary otherwise.
+func setConfigMapData(configMap *corev1.ConfigMap, data map[string][]byte) {
+	configMap.Data = make(map[string]string)
+	configMap.BinaryData = make(map[string][]byte)
+	for name, payload := range data {
+		if utf8.Valid(payload) {
+			configMap.Data[name] = string(payload)
+		} else {
+			configMap.BinaryData[name] = payload
+		}
+	}
+}
+
+// mergeObjectMeta set labels and annotations from desired metadata, keeping others in place.
+func mergeObjectMeta(existing *metav1.ObjectMeta, desired metav1.ObjectMeta) {
+	if len(desired.Labels) > 0 && existing.Labels == nil {
+		existing.Labels = make(map[string]string)
+	}
+	for k, v := range desired.Labels {
+		existing.Labels[k] = v
+	}
+	if len(desired.Annotations) > 0 && existing.Annotations == nil {
+		existing.Annotations = make(map[string]string)
+	}
+	for k, v := range desired.Annotations {
+		existing.Annotations[k] = v
+	}
+	for _, owner := range desired.OwnerReferences {
+		if !hasOwnerReference(*existing, owner) {
+			existing.OwnerReferences = append(existing.OwnerReferences, owner)
+		}
+	}
+}
+
+// hasOwnerReference check if metadata carries owner reference, by UID.
+func hasOwnerReference(meta metav1.ObjectMeta, owner metav1.OwnerReference) bool {
+	for _, existing := range meta.OwnerReferences {
+		if existing.UID == owner.UID {
+			return true
+		}
+	}
+	return false
+}
+
+// hasObjectMeta check if existing metadata contains all desired labels and annotations.
+func hasObjectMeta(existing, desired metav1.ObjectMeta) bool {
+	for k, v := range desired.Labels {
+		if existing.Labels[k] != v {
+			return false
+		}
+	}
+	for k, v := range desired.Annotations {
+		if existing.Annotations[k] != v {
+			return false
+		}
+	}
+	for _, owner := range desired.OwnerReferences {
+		if !hasOwnerReference(existing, owner) {
+			return false
+		}
+	}
+	return true
+}
+
+// Dynamic client, sharing the same configuration.
+func (k *Kubernetes) Dynamic() (dynamic.Interface, error) {
+	return dynamic.NewForConfig(k.config)
 }
 
 // localConfig read kube-config from home, or alternative path.
@@ -120,17 +354,17 @@ func (k *Kubernetes) localConfig() (*rest.Config, error) {
 	return clientcmd.BuildConfigFromFlags(k.context, k.kubeConfig)
 }
 
-// createNamespace is not found.
-func (k *Kubernetes) createNamespace() error {
+// createNamespace when not found.
+func (k *Kubernetes) createNamespace(namespace string) error {
 	var err error
 
-	if _, err = k.clientset.CoreV1().Namespaces().Get(k.namespace, metav1.GetOptions{}); err != nil {
+	if _, err = k.clientset.CoreV1().Namespaces().Get(namespace, metav1.GetOptions{}); err != nil {
 		if !errors.IsNotFound(err) {
 			return err
 		}
 
-		k.logger.Infof("Creating namespace '%s'", k.namespace)
-		spec := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: k.namespace}}
+		k.logger.Infof("Creating namespace '%s'", namespace)
+		spec := &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}}
 		if _, err = k.clientset.CoreV1().Namespaces().Create(spec); err != nil {
 			return err
 		}
@@ -139,16 +373,17 @@ func (k *Kubernetes) createNamespace() error {
 	return nil
 }
 
-// NewKubernetes instantiate object by checking if local or in-cluster configuration first.
-func NewKubernetes(kubeConfig, context, namespace string, inCluster bool) (*Kubernetes, error) {
+// NewKubernetes instantiate object by checking if local or in-cluster configuration first. Namespace
+// is informed per method call.
+func NewKubernetes(kubeConfig, context string, inCluster bool) (*Kubernetes, error) {
 	var cfg *rest.Config
 	var err error
 
 	logger := log.WithFields(log.Fields{
-		"kubeConfig": kubeConfig, "context": context, "namespace": namespace, "inCluster": inCluster,
+		"kubeConfig": kubeConfig, "context": context, "inCluster": inCluster,
 	})
 
-	k := &Kubernetes{logger: logger, kubeConfig: kubeConfig, context: context, namespace: namespace}
+	k := &Kubernetes{logger: logger, kubeConfig: kubeConfig, context: context}
 
 	if inCluster {
 		logger.Info("Using in-cluster Kubernetes client...")
@@ -162,12 +397,10 @@ func NewKubernetes(kubeConfig, context, namespace string, inCluster bool) (*Kube
 		}
 	}
 
+	k.config = cfg
 	if k.clientset, err = kubernetes.NewForConfig(cfg); err != nil {
 		return nil, err
 	}
-	if err = k.createNamespace(); err != nil {
-		return nil, err
-	}
 
 	return k, nil
 }
@@ -1,20 +1,31 @@
 package vaulthandler
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 var kube *Kubernetes
 
+const kubeNamespace = "default"
+
 func TestKubernetesNew(t *testing.T) {
 	var err error
 
 	kubeConfig := os.Getenv("KUBECONFIG")
 	t.Logf("Test kube-config: '%s'", kubeConfig)
-	kube, err = NewKubernetes(kubeConfig, "", "default", false)
+	kube, err = NewKubernetes(kubeConfig, "", false)
 
 	assert.Nil(t, err)
 }
@@ -22,21 +33,208 @@ func TestKubernetesNew(t *testing.T) {
 func TestKubernetesSecretWrite(t *testing.T) {
 	data := make(map[string][]byte)
 	data["test"] = []byte("test")
-	err := kube.SecretWrite("test", "", data)
+	err := kube.SecretWrite(kubeNamespace, metav1.ObjectMeta{Name: "test"}, "", data)
 
 	assert.Nil(t, err)
 }
 
 func TestKubernetesSecretExists(t *testing.T) {
-	exists, err := kube.SecretExists("test")
+	exists, err := kube.SecretExists(kubeNamespace, "test")
 
 	assert.Nil(t, err)
 	assert.True(t, exists)
 }
 
 func TestKubernetesSecretRead(t *testing.T) {
-	data, err := kube.SecretRead("test")
+	data, err := kube.SecretRead(kubeNamespace, "test")
 
 	assert.Nil(t, err)
 	assert.Equal(t, []byte("test"), data["test"])
 }
+
+func TestKubernetesSecretWriteKeepsMetadata(t *testing.T) {
+	secrets := kube.clientset.CoreV1().Secrets(kubeNamespace)
+
+	secret, err := secrets.Get("test", metav1.GetOptions{})
+	assert.Nil(t, err)
+	secret.Labels = map[string]string{"foreign": "label"}
+	_, err = secrets.Update(secret)
+	assert.Nil(t, err)
+
+	meta := metav1.ObjectMeta{Name: "test"}
+	err = kube.SecretWrite(kubeNamespace, meta, "", map[string][]byte{"test": []byte("updated")})
+	assert.Nil(t, err)
+
+	secret, err = secrets.Get("test", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, "label", secret.Labels["foreign"])
+	assert.Equal(t, []byte("updated"), secret.Data["test"])
+
+	// changing type recreates the secret, still keeping metadata
+	data := map[string][]byte{"test": []byte("test"), "username": []byte("username")}
+	err = kube.SecretWrite(kubeNamespace, meta, string(corev1.SecretTypeBasicAuth), data)
+	assert.Nil(t, err)
+
+	secret, err = secrets.Get("test", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, corev1.SecretTypeBasicAuth, secret.Type)
+	assert.Equal(t, "label", secret.Labels["foreign"])
+
+	err = kube.SecretWrite(kubeNamespace, meta, "", map[string][]byte{"test": []byte("test")})
+	assert.Nil(t, err)
+}
+
+func TestKubernetesSecretList(t *testing.T) {
+	meta := metav1.ObjectMeta{Name: "test-list", Labels: map[string]string{"test": "list"}}
+	err := kube.SecretWrite(kubeNamespace, meta, "", map[string][]byte{"test": []byte("test")})
+	assert.Nil(t, err)
+
+	secrets, err := kube.SecretList(kubeNamespace, "test=list")
+	assert.Nil(t, err)
+	assert.Len(t, secrets, 1)
+
+	err = kube.SecretDelete(kubeNamespace, "test-list")
+	assert.Nil(t, err)
+}
+
+func TestKubernetesSetConfigMapData(t *testing.T) {
+	configMap := &corev1.ConfigMap{}
+	setConfigMapData(configMap, map[string][]byte{"text": []byte("text"), "binary": {0xff, 0xfe}})
+
+	assert.Equal(t, map[string]string{"text": "text"}, configMap.Data)
+	assert.Equal(t, map[string][]byte{"binary": {0xff, 0xfe}}, configMap.BinaryData)
+}
+
+// newFakeKubernetes instance backed by a fake clientset, holding informed objects.
+func newFakeKubernetes(objects ...runtime.Object) (*Kubernetes, *fake.Clientset) {
+	clientset := fake.NewSimpleClientset(objects...)
+	return &Kubernetes{logger: log.WithField("test", "kubernetes"), clientset: clientset}, clientset
+}
+
+// conflictOnce reactor failing the first update of resource with a conflict.
+func conflictOnce(clientset *fake.Clientset, resource string) *int {
+	var updates int
+	clientset.PrependReactor("update", resource, func(k8stesting.Action) (bool, runtime.Object, error) {
+		updates++
+		if updates == 1 {
+			return true, nil, errors.NewConflict(schema.GroupResource{Resource: resource}, "test", nil)
+		}
+		return false, nil, nil
+	})
+	return &updates
+}
+
+// objectMeta object metadata on namespace, with informed labels.
+func objectMeta(namespace, name string, labels map[string]string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{Name: name, Namespace: namespace, Labels: labels}
+}
+
+// foreignMeta metadata added to objects by others, which must survive updates.
+func foreignMeta(name string) metav1.ObjectMeta {
+	return metav1.ObjectMeta{
+		Name:            name,
+		Namespace:       kubeNamespace,
+		UID:             "uid",
+		Labels:          map[string]string{"foreign": "label"},
+		Annotations:     map[string]string{"foreign": "annotation"},
+		OwnerReferences: []metav1.OwnerReference{{Kind: "Deployment", Name: "app", UID: "owner"}},
+	}
+}
+
+// assertForeignMeta check metadata added by others is kept, alongside desired metadata.
+func assertForeignMeta(t *testing.T, meta metav1.ObjectMeta) {
+	assert.Equal(t, "label", meta.Labels["foreign"])
+	assert.Equal(t, "annotation", meta.Annotations["foreign"])
+	assert.Equal(t, "vault-handler", meta.Labels[ManagedByLabel])
+	assert.Len(t, meta.OwnerReferences, 1)
+	assert.Equal(t, "owner", string(meta.OwnerReferences[0].UID))
+}
+
+func TestKubernetesSecretWriteFake(t *testing.T) {
+	existing := &corev1.Secret{
+		ObjectMeta: foreignMeta("test"),
+		Type:       corev1.SecretTypeOpaque,
+		Data:       map[string][]byte{"test": []byte("test")},
+	}
+	k, clientset := newFakeKubernetes(existing)
+	updates := conflictOnce(clientset, "secrets")
+
+	meta := metav1.ObjectMeta{Name: "test", Labels: map[string]string{ManagedByLabel: "vault-handler"}}
+	err := k.SecretWrite(kubeNamespace, meta, "", map[string][]byte{"test": []byte("updated")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *updates)
+
+	secret, err := k.SecretGet(kubeNamespace, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, []byte("updated"), secret.Data["test"])
+	assertForeignMeta(t, secret.ObjectMeta)
+
+	// changing type recreates the secret, still keeping metadata
+	data := map[string][]byte{"username": []byte("username")}
+	err = k.SecretWrite(kubeNamespace, meta, string(corev1.SecretTypeBasicAuth), data)
+	assert.Nil(t, err)
+
+	secret, err = k.SecretGet(kubeNamespace, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, corev1.SecretTypeBasicAuth, secret.Type)
+	assert.Equal(t, data, secret.Data)
+	assertForeignMeta(t, secret.ObjectMeta)
+
+	var verbs []string
+	for _, action := range clientset.Actions() {
+		if action.GetResource().Resource == "secrets" && action.GetVerb() != "get" {
+			verbs = append(verbs, action.GetVerb())
+		}
+	}
+	assert.Equal(t, []string{"update", "update", "delete", "create"}, verbs)
+}
+
+func TestKubernetesSecretRecreateRetry(t *testing.T) {
+	var creates int
+
+	existing := &corev1.Secret{ObjectMeta: foreignMeta("test"), Type: corev1.SecretTypeOpaque}
+	k, clientset := newFakeKubernetes(existing)
+	failures := 1
+	clientset.PrependReactor("create", "secrets", func(k8stesting.Action) (bool, runtime.Object, error) {
+		creates++
+		if creates <= failures {
+			return true, nil, errors.NewInternalError(fmt.Errorf("unavailable"))
+		}
+		return false, nil, nil
+	})
+
+	// creation is retried after the secret is deleted
+	meta := metav1.ObjectMeta{Name: "test", Labels: map[string]string{ManagedByLabel: "vault-handler"}}
+	data := map[string][]byte{"username": []byte("username")}
+	assert.Nil(t, k.SecretWrite(kubeNamespace, meta, string(corev1.SecretTypeBasicAuth), data))
+	assert.Equal(t, 2, creates)
+	secret, err := k.SecretGet(kubeNamespace, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, corev1.SecretTypeBasicAuth, secret.Type)
+	assertForeignMeta(t, secret.ObjectMeta)
+
+	// giving up informs the secret is deleted
+	creates, failures = 0, 100
+	err = k.SecretWrite(kubeNamespace, meta, string(corev1.SecretTypeOpaque), data)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "was deleted")
+	secret, err = k.SecretGet(kubeNamespace, "test")
+	assert.Nil(t, err)
+	assert.Nil(t, secret)
+}
+
+func TestKubernetesConfigMapWriteFake(t *testing.T) {
+	existing := &corev1.ConfigMap{ObjectMeta: foreignMeta("test"), Data: map[string]string{"test": "test"}}
+	k, clientset := newFakeKubernetes(existing)
+	updates := conflictOnce(clientset, "configmaps")
+
+	meta := metav1.ObjectMeta{Name: "test", Labels: map[string]string{ManagedByLabel: "vault-handler"}}
+	err := k.ConfigMapWrite(kubeNamespace, meta, map[string][]byte{"test": []byte("updated")})
+	assert.Nil(t, err)
+	assert.Equal(t, 2, *updates)
+
+	configMap, err := k.ConfigMapGet(kubeNamespace, "test")
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"test": "updated"}, configMap.Data)
+	assertForeignMeta(t, configMap.ObjectMeta)
+}
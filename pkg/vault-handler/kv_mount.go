@@ -0,0 +1,46 @@
+package vaulthandler
+
+import (
+	"path"
+	"strings"
+)
+
+// kvMount secrets engine mount, and the key-value version it's using.
+type kvMount struct {
+	path    string // mount path, with trailing slash
+	version int    // key-value engine version
+}
+
+// isV2 checks if mount is using key-value version 2.
+func (m *kvMount) isV2() bool {
+	return m.version == 2
+}
+
+// apiPath translate a path informed in manifest to the API path, where on version 2 the kind of
+// endpoint ("data" or "metadata") is placed right after the mount path. Manifest paths already
+// having "data" after the mount path are kept as they are.
+func (m *kvMount) apiPath(secretPath, kind string) string {
+	secretPath = strings.Trim(secretPath, "/")
+	if !m.isV2() {
+		return secretPath
+	}
+	relative := strings.TrimPrefix(secretPath+"/", m.path)
+	relative = strings.TrimPrefix(relative, "data/")
+	return strings.TrimSuffix(path.Join(m.path, kind, relative), "/")
+}
+
+// hasPrefix checks if the informed path is under this mount.
+func (m *kvMount) hasPrefix(secretPath string) bool {
+	return strings.HasPrefix(strings.Trim(secretPath, "/")+"/", m.path)
+}
+
+// guessMount is employed when mount can't be inspected, using first path element as mount path, and
+// assuming version 2 when followed by "data".
+func guessMount(secretPath string) *kvMount {
+	parts := strings.SplitN(strings.Trim(secretPath, "/"), "/", 3)
+	m := &kvMount{path: parts[0] + "/", version: 1}
+	if len(parts) > 1 && parts[1] == "data" {
+		m.version = 2
+	}
+	return m
+}
@@ -0,0 +1,38 @@
+package vaulthandler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKVMountAPIPath(t *testing.T) {
+	v1 := &kvMount{path: "kv/", version: 1}
+	assert.Equal(t, "kv/app/db", v1.apiPath("/kv/app/db", "data"))
+
+	v2 := &kvMount{path: "kv/", version: 2}
+	assert.Equal(t, "kv/data/app/db", v2.apiPath("kv/app/db", "data"))
+	assert.Equal(t, "kv/metadata/app/db", v2.apiPath("kv/app/db", "metadata"))
+	assert.Equal(t, "kv/data/app/db", v2.apiPath("kv/data/app/db", "data"))
+	assert.Equal(t, "kv/metadata/app/db", v2.apiPath("kv/data/app/db", "metadata"))
+
+	nested := &kvMount{path: "team/kv/", version: 2}
+	assert.Equal(t, "team/kv/data/app", nested.apiPath("team/kv/app", "data"))
+}
+
+func TestKVMountHasPrefix(t *testing.T) {
+	m := &kvMount{path: "kv/", version: 2}
+	assert.True(t, m.hasPrefix("kv/app/db"))
+	assert.True(t, m.hasPrefix("/kv"))
+	assert.False(t, m.hasPrefix("kv2/app/db"))
+}
+
+func TestKVMountGuessMount(t *testing.T) {
+	m := guessMount("secret/data/app")
+	assert.Equal(t, "secret/", m.path)
+	assert.True(t, m.isV2())
+
+	m = guessMount("secret/app")
+	assert.Equal(t, "secret/", m.path)
+	assert.False(t, m.isV2())
+}
@@ -0,0 +1,339 @@
+package vaulthandler
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/validation"
+)
+
+// ManifestError problem found on manifest, with position when known.
+type ManifestError struct {
+	File    string // manifest file path
+	Line    int    // line number, zero when unknown
+	Column  int    // column number, zero when unknown
+	Field   string // field path, like "secrets.group.data[0].name"
+	Message string // problem description
+}
+
+// Error formats error as "file:line:column: field: message", omitting what is unknown.
+func (e *ManifestError) Error() string {
+	location := e.File
+	if e.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, e.Line)
+	}
+	if e.Column > 0 {
+		location = fmt.Sprintf("%s:%d", location, e.Column)
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", location, e.Message)
+	}
+	return fmt.Sprintf("%s: %s: %s", location, e.Field, e.Message)
+}
+
+// ManifestErrors all problems found on manifest.
+type ManifestErrors []*ManifestError
+
+// Error one problem per line.
+func (e ManifestErrors) Error() string {
+	var lines []string
+	for _, err := range e {
+		lines = append(lines, err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// yamlErrors convert YAML syntax and decoding errors, extracting line numbers from messages.
+func yamlErrors(file string, err error) ManifestErrors {
+	messages := []string{strings.TrimPrefix(err.Error(), "yaml: ")}
+	if typeErr, ok := err.(*yaml.TypeError); ok {
+		messages = typeErr.Errors
+	}
+
+	errs := ManifestErrors{}
+	for _, message := range messages {
+		manifestErr := &ManifestError{File: file, Message: message}
+		if n, _ := fmt.Sscanf(message, "line %d:", &manifestErr.Line); n == 1 {
+			manifestErr.Message = strings.TrimSpace(message[strings.Index(message, ":")+1:])
+		}
+		errs = append(errs, manifestErr)
+	}
+	return errs
+}
+
+// orNil sort errors by position, returning nil when empty.
+func (e ManifestErrors) orNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	sort.SliceStable(e, func(i, j int) bool {
+		if e[i].Line != e[j].Line {
+			return e[i].Line < e[j].Line
+		}
+		return e[i].Column < e[j].Column
+	})
+	return e
+}
+
+// fieldPath join field path segments.
+func fieldPath(parent, name string) string {
+	if parent == "" {
+		return name
+	}
+	return fmt.Sprintf("%s.%s", parent, name)
+}
+
+// index walk YAML nodes alongside informed type, recording nodes per field path, and reporting
+// fields unknown to type.
+func (m *Manifest) index(node *yaml.Node, t reflect.Type, field string, errs *ManifestErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			m.index(child, t, field, errs)
+		}
+		return
+	case yaml.AliasNode:
+		m.index(node.Alias, t, field, errs)
+		return
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		fields := make(map[string]reflect.Type)
+		for i := 0; i < t.NumField(); i++ {
+			name := strings.Split(t.Field(i).Tag.Get("yaml"), ",")[0]
+			if name != "" && name != "-" {
+				fields[name] = t.Field(i).Type
+			}
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := fieldPath(field, key.Value)
+			m.nodes[child] = key
+			fieldType, found := fields[key.Value]
+			if !found {
+				*errs = append(*errs, m.errorAt(child, "field is not expected"))
+				continue
+			}
+			m.index(value, fieldType, child, errs)
+		}
+	case reflect.Map:
+		if node.Kind != yaml.MappingNode {
+			return
+		}
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			key, value := node.Content[i], node.Content[i+1]
+			child := fieldPath(field, key.Value)
+			m.nodes[child] = key
+			m.index(value, t.Elem(), child, errs)
+		}
+	case reflect.Slice:
+		if node.Kind != yaml.SequenceNode {
+			return
+		}
+		for i, item := range node.Content {
+			child := fmt.Sprintf("%s[%d]", field, i)
+			m.nodes[child] = item
+			m.index(item, t.Elem(), child, errs)
+		}
+	}
+}
+
+// errorAt compose a error on field, using position of the first field path found, falling back to
+// the following ones, used when field is not present on manifest.
+func (m *Manifest) errorAt(field string, message string, fallbacks ...string) *ManifestError {
+	err := &ManifestError{File: m.File, Field: field, Message: message}
+	for _, candidate := range append([]string{field}, fallbacks...) {
+		if node, found := m.nodes[candidate]; found {
+			err.Line = node.Line
+			err.Column = node.Column
+			break
+		}
+	}
+	return err
+}
+
+// groups sorted group names.
+func (m *Manifest) groups() []string {
+	var groups []string
+	for group := range m.Secrets {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups
+}
+
+// Validate manifest required fields, duplicated names and file names, including template targets,
+// and Kubernetes kind and type combination. Returns ManifestErrors.
+func (m *Manifest) Validate() error {
+	errs := ManifestErrors{}
+	fileNames := make(map[string]string)
+
+	if len(m.Secrets) == 0 {
+		errs = append(errs, m.errorAt("secrets", "secrets are not informed"))
+	}
+	for _, group := range m.groups() {
+		secrets := m.Secrets[group]
+		groupField := fieldPath("secrets", group)
+		at := func(name, message string, args ...interface{}) {
+			field := fieldPath(groupField, name)
+			errs = append(errs, m.errorAt(field, fmt.Sprintf(message, args...), groupField))
+		}
+
+		if secrets.Path == "" {
+			at("path", "path is not informed")
+		}
+		if secrets.Kind != "" && secrets.Kind != SecretKind && secrets.Kind != ConfigMapKind {
+			at("kind", "kind '%s' is not supported, use %s or %s", secrets.Kind, SecretKind, ConfigMapKind)
+		}
+		if secrets.Kind == ConfigMapKind && secrets.Type != "" {
+			at("type", "type can't be used with kind %s", ConfigMapKind)
+		}
+		if secrets.Strategy != "" && !isUploadStrategy(secrets.Strategy) {
+			at("strategy", "strategy '%s' is not supported, use replace, merge or patch", secrets.Strategy)
+		}
+		if secrets.Version < 0 {
+			at("version", "version must not be negative")
+		}
+		if len(secrets.Data) == 0 {
+			at("data", "data is not informed")
+		}
+
+		names := make(map[string]bool)
+		for i, data := range secrets.Data {
+			dataField := fmt.Sprintf("%s.data[%d]", groupField, i)
+			dataAt := func(name, message string, args ...interface{}) {
+				field := fieldPath(dataField, name)
+				errs = append(errs, m.errorAt(field, fmt.Sprintf(message, args...), dataField))
+			}
+
+			if data.Name == "" {
+				dataAt("name", "name is not informed")
+				continue
+			}
+			if names[data.Name] {
+				dataAt("name", "name '%s' is declared more than once in group", data.Name)
+				continue
+			}
+			names[data.Name] = true
+			if data.Version < 0 {
+				dataAt("version", "version must not be negative")
+			}
+
+			fileName := NewFile(group, secrets.Type, &secrets.Data[i], nil).fileName()
+			if other, found := fileNames[fileName]; found {
+				dataAt("name", "file name '%s' collides with '%s'", fileName, other)
+			} else {
+				fileNames[fileName] = dataField
+			}
+		}
+	}
+
+	for i, tmpl := range m.Templates {
+		tmplField := fmt.Sprintf("templates[%d]", i)
+		at := func(name, message string, args ...interface{}) {
+			field := fieldPath(tmplField, name)
+			errs = append(errs, m.errorAt(field, fmt.Sprintf(message, args...), tmplField))
+		}
+
+		if tmpl.Source == "" {
+			at("source", "source is not informed")
+		}
+		if tmpl.Target == "" {
+			at("target", "target is not informed")
+			continue
+		}
+		if tmpl.Target == "." || tmpl.Target == ".." || strings.ContainsAny(tmpl.Target, `/\`) {
+			at("target", "target '%s' must be a file name, without directories", tmpl.Target)
+			continue
+		}
+		if other, found := fileNames[tmpl.Target]; found {
+			at("target", "target '%s' collides with '%s'", tmpl.Target, other)
+		} else {
+			fileNames[tmpl.Target] = tmplField
+		}
+	}
+
+	return errs.orNil()
+}
+
+// ValidateKubernetes validate manifest, Kubernetes naming rules of objects, namespaces, keys, labels,
+// annotations and workloads, and keys required by built-in secret types. Returns ManifestErrors.
+func (m *Manifest) ValidateKubernetes() error {
+	errs := ManifestErrors{}
+	if err := m.Validate(); err != nil {
+		errs = append(errs, err.(ManifestErrors)...)
+	}
+
+	for _, group := range m.groups() {
+		secrets := m.Secrets[group]
+		groupField := fieldPath("secrets", group)
+		check := func(field string, problems []string) {
+			for _, problem := range problems {
+				errs = append(errs, m.errorAt(field, problem, groupField))
+			}
+		}
+
+		check(groupField, validation.IsDNS1123Subdomain(group))
+		if secrets.Kind == "" || secrets.Kind == SecretKind {
+			var names []string
+			for _, data := range secrets.Data {
+				names = append(names, data.Name)
+			}
+			check(fieldPath(groupField, "type"), missingSecretTypeKeys(secrets.Type, names))
+			if corev1.SecretType(secrets.Type) == corev1.SecretTypeServiceAccountToken &&
+				secrets.Annotations[corev1.ServiceAccountNameKey] == "" {
+				check(fieldPath(groupField, "annotations"), []string{fmt.Sprintf(
+					"type '%s' requires annotation '%s'", secrets.Type, corev1.ServiceAccountNameKey)})
+			}
+		}
+		if secrets.Namespace != "" {
+			check(fieldPath(groupField, "namespace"), validation.IsDNS1123Label(secrets.Namespace))
+		}
+		for i, namespace := range secrets.Namespaces {
+			check(fmt.Sprintf("%s.namespaces[%d]", groupField, i), validation.IsDNS1123Label(namespace))
+		}
+		for i, data := range secrets.Data {
+			if data.Name != "" {
+				check(fmt.Sprintf("%s.data[%d].name", groupField, i), validation.IsConfigMapKey(data.Name))
+			}
+		}
+		for k, v := range secrets.Labels {
+			field := fieldPath(fieldPath(groupField, "labels"), k)
+			check(field, validation.IsQualifiedName(k))
+			check(field, validation.IsValidLabelValue(v))
+		}
+		for k := range secrets.Annotations {
+			check(fieldPath(fieldPath(groupField, "annotations"), k), validation.IsQualifiedName(k))
+		}
+
+		workloadsField := fieldPath(groupField, "workloads")
+		for kind, names := range map[string][]string{
+			"deployments":  secrets.Workloads.Deployments,
+			"statefulSets": secrets.Workloads.StatefulSets,
+			"daemonSets":   secrets.Workloads.DaemonSets,
+		} {
+			for i, name := range names {
+				check(fmt.Sprintf("%s.%s[%d]", workloadsField, kind, i), validation.IsDNS1123Subdomain(name))
+			}
+		}
+		if secrets.Workloads.Selector != "" {
+			if _, err := labels.Parse(secrets.Workloads.Selector); err != nil {
+				check(fieldPath(workloadsField, "selector"), []string{err.Error()})
+			}
+		}
+	}
+
+	return errs.orNil()
+}
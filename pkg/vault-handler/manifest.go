@@ -1,19 +1,64 @@
 package vaulthandler
 
 import (
-	yaml "gopkg.in/yaml.v2"
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+const (
+	// SecretKind group is copied to Kubernetes as a Secret, default.
+	SecretKind = "Secret"
+	// ConfigMapKind group is copied to Kubernetes as a ConfigMap, for non-sensitive entries.
+	ConfigMapKind = "ConfigMap"
 )
 
 // Manifest to be applied against Vault, define secrets.
 type Manifest struct {
-	Secrets map[string]Secrets `yaml:"secrets"`
+	File      string                `yaml:"-"`                   // manifest file path
+	Name      string                `yaml:"name,omitempty"`      // owner identity of objects written
+	Secrets   map[string]Secrets    `yaml:"secrets"`             // secrets per group name
+	Templates []Template            `yaml:"templates,omitempty"` // templates rendered with secrets
+	nodes     map[string]*yaml.Node // yaml nodes per field path, to report positions
+}
+
+// Template file rendered with downloaded secrets, written on output directory.
+type Template struct {
+	Source string `yaml:"source"` // template file, relative to manifest directory
+	Target string `yaml:"target"` // file name written on output directory
 }
 
 // Secrets map with group-name, metadata and secrets list.
 type Secrets struct {
-	Path string       `yaml:"path"`           // vault path
-	Type string       `yaml:"type,omitempty"` // kubernetes secret type
-	Data []SecretData `yaml:"data"`           // secret entries
+	Path        string            `yaml:"path"`                  // vault path
+	Type        string            `yaml:"type,omitempty"`        // kubernetes secret type
+	Kind        string            `yaml:"kind,omitempty"`        // kubernetes kind (Secret or ConfigMap)
+	Version     int               `yaml:"version,omitempty"`     // default secret version, on kv-v2
+	Strategy    string            `yaml:"strategy,omitempty"`    // upload strategy (replace, merge or patch)
+	Namespace   string            `yaml:"namespace,omitempty"`   // kubernetes namespace
+	Namespaces  []string          `yaml:"namespaces,omitempty"`  // kubernetes namespaces, fan-out
+	Labels      map[string]string `yaml:"labels,omitempty"`      // kubernetes secret labels
+	Annotations map[string]string `yaml:"annotations,omitempty"` // kubernetes secret annotations
+	Workloads   Workloads         `yaml:"workloads,omitempty"`   // workloads restarted on changes
+	Data        []SecretData      `yaml:"data"`                  // secret entries
+}
+
+// Workloads depending on a group, restarted when it changes in Kubernetes.
+type Workloads struct {
+	Deployments  []string `yaml:"deployments,omitempty"`  // deployment names
+	StatefulSets []string `yaml:"statefulSets,omitempty"` // stateful-set names
+	DaemonSets   []string `yaml:"daemonSets,omitempty"`   // daemon-set names
+	Selector     string   `yaml:"selector,omitempty"`     // label selector, for all workload kinds
+}
+
+// Empty when no workload is informed.
+func (w *Workloads) Empty() bool {
+	return len(w.Deployments) == 0 && len(w.StatefulSets) == 0 && len(w.DaemonSets) == 0 &&
+		w.Selector == ""
 }
 
 // SecretData define a single secret in Vault, mapping to a regular file.
@@ -24,16 +69,88 @@ type SecretData struct {
 	NameAsSubPath bool   `yaml:"nameAsSubPath,omitempty"` // employ name as part of the path
 	Key           string `yaml:"key,omitempty"`           // vault key
 	FromEnv       string `yaml:"fromEnv,omitempty"`       // load payload from environment
+	Version       int    `yaml:"version,omitempty"`       // pinned secret version, on kv-v2
+}
+
+// TargetNamespaces kubernetes namespaces for the group, combining namespace and namespaces, or the
+// informed default when none is set.
+func (s *Secrets) TargetNamespaces(defaultNamespace string) []string {
+	var namespaces []string
+
+	seen := make(map[string]bool)
+	for _, namespace := range append([]string{s.Namespace}, s.Namespaces...) {
+		if namespace == "" || seen[namespace] {
+			continue
+		}
+		seen[namespace] = true
+		namespaces = append(namespaces, namespace)
+	}
+	if len(namespaces) == 0 && defaultNamespace != "" {
+		namespaces = append(namespaces, defaultNamespace)
+	}
+	return namespaces
 }
 
-// NewManifest by parsing informed manifest file.
+// TemplatePath template source path, relative paths are based on manifest file directory.
+func (m *Manifest) TemplatePath(tmpl Template) string {
+	if filepath.IsAbs(tmpl.Source) {
+		return tmpl.Source
+	}
+	return filepath.Join(filepath.Dir(m.File), tmpl.Source)
+}
+
+// ID short hash of manifest name, or absolute manifest file path when name is not informed, in
+// order to identify the resources it owns.
+func (m *Manifest) ID() string {
+	identity := m.Name
+	if identity == "" {
+		identity = filepath.Clean(m.File)
+		if abs, err := filepath.Abs(m.File); err == nil {
+			identity = abs
+		}
+	}
+	sum := sha256.Sum256([]byte(identity))
+	return hex.EncodeToString(sum[:])[:16]
+}
+
+// NewManifest by parsing informed manifest file strictly, and validating it.
 func NewManifest(file string) (*Manifest, error) {
+	var manifest *Manifest
+	var payload []byte
 	var err error
 
-	manifest := Manifest{}
-	if err = yaml.Unmarshal(readFile(file), &manifest); err != nil {
+	if payload, err = ioutil.ReadFile(file); err != nil {
+		return nil, err
+	}
+	if manifest, err = ParseManifest(file, payload); err != nil {
+		return nil, err
+	}
+	if err = manifest.Validate(); err != nil {
 		return nil, err
 	}
+	return manifest, nil
+}
+
+// ParseManifest decode manifest payload, rejecting fields unknown to manifest schema. Errors are
+// ManifestErrors, carrying line and column.
+func ParseManifest(file string, payload []byte) (*Manifest, error) {
+	var node yaml.Node
+
+	manifest := &Manifest{File: file, nodes: make(map[string]*yaml.Node)}
+	if err := yaml.Unmarshal(payload, &node); err != nil {
+		return nil, yamlErrors(file, err)
+	}
 
-	return &manifest, nil
+	errs := ManifestErrors{}
+	manifest.index(&node, reflect.TypeOf(manifest).Elem(), "", &errs)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if node.Kind == 0 {
+		return manifest, nil
+	}
+	if err := node.Decode(manifest); err != nil {
+		return nil, yamlErrors(file, err)
+	}
+	return manifest, nil
 }
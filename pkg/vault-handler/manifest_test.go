@@ -1,6 +1,7 @@
 package vaulthandler
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -15,4 +16,198 @@ func TestManifestNew(t *testing.T) {
 
 	assert.NotNil(t, manifest)
 	assert.Nil(t, err)
+	assert.Nil(t, manifest.ValidateKubernetes())
+}
+
+func TestManifestID(t *testing.T) {
+	m := &Manifest{File: "./test/manifest.yaml"}
+	assert.Len(t, m.ID(), 16)
+	assert.Equal(t, m.ID(), (&Manifest{File: "test/manifest.yaml"}).ID())
+	assert.NotEqual(t, m.ID(), (&Manifest{File: "other/manifest.yaml"}).ID())
+
+	abs, err := filepath.Abs("test/manifest.yaml")
+	assert.Nil(t, err)
+	assert.Equal(t, m.ID(), (&Manifest{File: abs}).ID())
+
+	// name is the identity, regardless of file path
+	named := &Manifest{File: "test/manifest.yaml", Name: "app"}
+	assert.NotEqual(t, m.ID(), named.ID())
+	assert.Equal(t, named.ID(), (&Manifest{File: "/ci/build-42/manifest.yaml", Name: "app"}).ID())
+}
+
+func TestManifestTargetNamespaces(t *testing.T) {
+	secrets := Secrets{}
+	assert.Equal(t, []string{"default"}, secrets.TargetNamespaces("default"))
+	assert.Len(t, secrets.TargetNamespaces(""), 0)
+
+	secrets = Secrets{Namespace: "a", Namespaces: []string{"b", "a", "c"}}
+	assert.Equal(t, []string{"a", "b", "c"}, secrets.TargetNamespaces("default"))
+}
+
+func TestManifestWorkloadsEmpty(t *testing.T) {
+	assert.True(t, (&Workloads{}).Empty())
+	assert.False(t, (&Workloads{Selector: "app=app"}).Empty())
+}
+
+func TestManifestParseStrict(t *testing.T) {
+	payload := []byte(`---
+secrets:
+  app:
+    path: secret/app
+    data:
+      - name: password
+        nameAsSubpath: true
+`)
+	_, err := ParseManifest("manifest.yaml", payload)
+	assert.NotNil(t, err)
+	errs, ok := err.(ManifestErrors)
+	assert.True(t, ok)
+	assert.Len(t, errs, 1)
+	assert.Equal(t, "manifest.yaml:7:9: secrets.app.data[0].nameAsSubpath: field is not expected",
+		errs[0].Error())
+
+	_, err = ParseManifest("manifest.yaml", []byte("secrets:\n  app:\n    version: latest\n"))
+	assert.NotNil(t, err)
+	assert.Equal(t, 3, err.(ManifestErrors)[0].Line)
+
+	_, err = ParseManifest("manifest.yaml", []byte("secrets: [\n"))
+	assert.NotNil(t, err)
+}
+
+func TestManifestValidate(t *testing.T) {
+	payload := []byte(`---
+secrets:
+  app:
+    kind: ConfigMap
+    type: Opaque
+    data:
+      - name: password
+      - name: password
+      - extension: txt
+      - name: pass.word
+        extension: txt
+  app.pass:
+    path: secret/other
+    data:
+      - name: word
+        extension: txt
+`)
+	m, err := ParseManifest("manifest.yaml", payload)
+	assert.Nil(t, err)
+
+	err = m.Validate()
+	assert.NotNil(t, err)
+	var messages []string
+	for _, manifestErr := range err.(ManifestErrors) {
+		messages = append(messages, manifestErr.Error())
+	}
+	assert.Equal(t, []string{
+		"manifest.yaml:3:3: secrets.app.path: path is not informed",
+		"manifest.yaml:5:5: secrets.app.type: type can't be used with kind ConfigMap",
+		"manifest.yaml:8:9: secrets.app.data[1].name: name 'password' is declared more than once in group",
+		"manifest.yaml:9:9: secrets.app.data[2].name: name is not informed",
+		"manifest.yaml:15:9: secrets.app.pass.data[0].name: " +
+			"file name 'app.pass.word.txt' collides with 'secrets.app.data[3]'",
+	}, messages)
+
+	assert.NotNil(t, (&Manifest{}).Validate())
+	assert.Nil(t, manifest.Validate())
+}
+
+func TestManifestValidateTemplates(t *testing.T) {
+	payload := []byte(`---
+secrets:
+  app:
+    path: secret/app
+    data:
+      - name: password
+        extension: txt
+templates:
+  - source: database.yml.tmpl
+    target: database.yml
+  - source: database.yml.tmpl
+    target: database.yml
+  - target: ../etc/passwd
+  - source: other.tmpl
+    target: app.password.txt
+`)
+	m, err := ParseManifest("manifest.yaml", payload)
+	assert.Nil(t, err)
+	assert.Equal(t, "database.yml.tmpl", m.TemplatePath(m.Templates[0]))
+
+	err = m.Validate()
+	assert.NotNil(t, err)
+	var messages []string
+	for _, manifestErr := range err.(ManifestErrors) {
+		messages = append(messages, manifestErr.Error())
+	}
+	assert.Equal(t, []string{
+		"manifest.yaml:12:5: templates[1].target: target 'database.yml' collides with 'templates[0]'",
+		"manifest.yaml:13:5: templates[2].source: source is not informed",
+		"manifest.yaml:13:5: templates[2].target: target '../etc/passwd' must be a file name, " +
+			"without directories",
+		"manifest.yaml:15:5: templates[3].target: " +
+			"target 'app.password.txt' collides with 'secrets.app.data[0]'",
+	}, messages)
+
+	m.File = "/etc/vault-handler/manifest.yaml"
+	assert.Equal(t, "/etc/vault-handler/database.yml.tmpl", m.TemplatePath(m.Templates[0]))
+	assert.Equal(t, "/tmp/a.tmpl", m.TemplatePath(Template{Source: "/tmp/a.tmpl"}))
+}
+
+func TestManifestValidateKubernetes(t *testing.T) {
+	payload := []byte(`---
+secrets:
+  My_Secret:
+    path: secret/app
+    namespaces: [default, Invalid]
+    labels:
+      team: "a b"
+    workloads:
+      selector: "app in ("
+    data:
+      - name: "pass word"
+`)
+	m, err := ParseManifest("manifest.yaml", payload)
+	assert.Nil(t, err)
+	assert.Nil(t, m.Validate())
+
+	err = m.ValidateKubernetes()
+	assert.NotNil(t, err)
+	var fields []string
+	for _, manifestErr := range err.(ManifestErrors) {
+		fields = append(fields, manifestErr.Field)
+	}
+	assert.Equal(t, []string{
+		"secrets.My_Secret",
+		"secrets.My_Secret.namespaces[1]",
+		"secrets.My_Secret.labels.team",
+		"secrets.My_Secret.workloads.selector",
+		"secrets.My_Secret.data[0].name",
+	}, fields)
+}
+
+func TestManifestValidateKubernetesSecretType(t *testing.T) {
+	m, err := ParseManifest("manifest.yaml", []byte(`---
+secrets:
+  tls:
+    path: secret/tls
+    type: kubernetes.io/tls
+    data:
+      - name: tls.crt
+  token:
+    path: secret/token
+    type: kubernetes.io/service-account-token
+    data:
+      - name: token
+`))
+	assert.Nil(t, err)
+
+	err = m.ValidateKubernetes()
+	assert.NotNil(t, err)
+	assert.Equal(t, "manifest.yaml:5:5: secrets.tls.type: "+
+		"type 'kubernetes.io/tls' requires key 'tls.key', add it to data\n"+
+		"manifest.yaml:8:3: secrets.token.annotations: "+
+		"type 'kubernetes.io/service-account-token' requires annotation 'kubernetes.io/service-account.name'",
+		err.Error())
 }
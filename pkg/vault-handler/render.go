@@ -0,0 +1,132 @@
+package vaulthandler
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/ghodss/yaml"
+	log "github.com/sirupsen/logrus"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// K8sYAMLFormat render Kubernetes objects as YAML documents.
+const K8sYAMLFormat = "k8s-yaml"
+
+// document rendered, with the file name employed when writing to a directory.
+type document struct {
+	name    string // file name
+	payload []byte // rendered contents
+}
+
+// Render Kubernetes objects based on secrets downloaded from Vault, without calling Kubernetes API.
+// Objects are composed in the same way than copy, one per group and namespace.
+type Render struct {
+	logger    *log.Entry  // logger
+	copy      *Copy       // copy instance, without api-client, to compose objects
+	format    string      // output format
+	outputDir string      // output directory, empty means writer
+	out       io.Writer   // writer employed when output directory is empty
+	documents []*document // rendered documents
+}
+
+// Prepare by composing a Kubernetes object per group, on each namespace it targets. Namespace is
+// left out when not informed.
+func (r *Render) Prepare() error {
+	var data map[string][]byte
+	var payload []byte
+	var err error
+
+	if r.format != K8sYAMLFormat {
+		return fmt.Errorf("render format '%s' is not supported, use %s", r.format, K8sYAMLFormat)
+	}
+
+	groups, files := r.copy.groupFiles()
+	for _, group := range groups {
+		if err = r.copy.setSecretType(group, files[group][0]); err != nil {
+			return err
+		}
+		if err = r.copy.validateData(group, files[group]); err != nil {
+			return err
+		}
+		if data, err = groupData(files[group]); err != nil {
+			return err
+		}
+		hash := secretHash(r.copy.secretType[group], data)
+
+		namespaces := r.copy.namespaces(group)
+		if len(namespaces) == 0 {
+			namespaces = []string{""}
+		}
+		for _, namespace := range namespaces {
+			meta := r.copy.objectMeta(group, files[group][0], hash)
+			meta.Namespace = namespace
+			if payload, err = yaml.Marshal(r.object(meta, data)); err != nil {
+				return err
+			}
+
+			name := fmt.Sprintf("%s.yaml", group)
+			if namespace != "" {
+				name = fmt.Sprintf("%s.%s.yaml", namespace, group)
+			}
+			r.logger.WithFields(log.Fields{"namespace": namespace, "group": group}).
+				Infof("Rendering Kubernetes %s", r.copy.kind(group))
+			r.documents = append(r.documents, &document{name: name, payload: payload})
+		}
+	}
+	return nil
+}
+
+// object compose secret, or config-map, according to group kind.
+func (r *Render) object(meta metav1.ObjectMeta, data map[string][]byte) interface{} {
+	if r.copy.kind(meta.Name) == ConfigMapKind {
+		configMap := &corev1.ConfigMap{
+			TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: ConfigMapKind},
+			ObjectMeta: meta,
+		}
+		setConfigMapData(configMap, data)
+		return configMap
+	}
+	return &corev1.Secret{
+		TypeMeta:   metav1.TypeMeta{APIVersion: "v1", Kind: SecretKind},
+		ObjectMeta: meta,
+		Type:       corev1.SecretType(r.copy.secretType[meta.Name]),
+		Data:       data,
+	}
+}
+
+// Execute write rendered documents, one file per document in output directory, or as a multi
+// document YAML stream on writer.
+func (r *Render) Execute(dryRun bool) error {
+	for _, doc := range r.documents {
+		if dryRun {
+			r.logger.Infof("[DRY-RUN] Document '%s' (%d bytes)", doc.name, len(doc.payload))
+			continue
+		}
+		if r.outputDir != "" {
+			r.logger.WithField("outputDir", r.outputDir).Infof("Writing document '%s'", doc.name)
+			if err := writeAtomic(r.outputDir, doc.name, doc.payload); err != nil {
+				return err
+			}
+			continue
+		}
+		if _, err := fmt.Fprintf(r.out, "---\n%s", doc.payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewRender creates a new Render instance, namespace is the default for groups not informing it.
+// Documents are written on output directory, or on writer when directory is empty.
+func NewRender(
+	download *Download, manifest *Manifest, namespace, format, outputDir string, out io.Writer,
+) *Render {
+	return &Render{
+		logger:    log.WithFields(log.Fields{"type": "render", "format": format}),
+		copy:      NewCopy(nil, download, manifest, namespace),
+		format:    format,
+		outputDir: outputDir,
+		out:       out,
+	}
+}
@@ -0,0 +1,86 @@
+package vaulthandler
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/ghodss/yaml"
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+func TestRender(t *testing.T) {
+	manifest := &Manifest{File: "manifest.yaml", Secrets: map[string]Secrets{
+		"app":    {Path: "kv/app", Type: "kubernetes.io/basic-auth", Namespaces: []string{"a", "b"}},
+		"config": {Path: "kv/config", Kind: ConfigMapKind},
+		"tls":    {Path: "kv/tls", Type: "kubernetes.io/tls"},
+	}}
+	crt, key := testCertificate(t, time.Now().Add(time.Hour), nil)
+	d := NewDownload(nil, "")
+	d.Files = []*File{
+		NewFile("app", "kubernetes.io/basic-auth", &SecretData{Name: "username"}, []byte("user")),
+		NewFile("app", "kubernetes.io/basic-auth", &SecretData{Name: "password"}, []byte("pass")),
+		NewFile("config", "", &SecretData{Name: "setting"}, []byte("value")),
+		NewFile("tls", "kubernetes.io/tls", &SecretData{Name: "tls.crt"}, crt),
+		NewFile("tls", "kubernetes.io/tls", &SecretData{Name: "tls.key"}, key),
+	}
+
+	var out bytes.Buffer
+	r := NewRender(d, manifest, "", K8sYAMLFormat, "", &out)
+	assert.Nil(t, r.Prepare())
+	assert.Nil(t, r.Execute(true))
+	assert.Equal(t, 0, out.Len())
+
+	assert.Nil(t, r.Execute(false))
+	docs := bytes.Split(out.Bytes(), []byte("---\n"))
+	assert.Len(t, docs, 5)
+
+	var secret corev1.Secret
+	assert.Nil(t, yaml.Unmarshal(docs[1], &secret))
+	assert.Equal(t, "Secret", secret.Kind)
+	assert.Equal(t, "a", secret.Namespace)
+	assert.Equal(t, "app", secret.Name)
+	assert.Equal(t, corev1.SecretType("kubernetes.io/basic-auth"), secret.Type)
+	assert.Equal(t, map[string][]byte{"username": []byte("user"), "password": []byte("pass")}, secret.Data)
+	assert.Equal(t, "kv/app", secret.Annotations[VaultPathAnnotation])
+
+	var configMap corev1.ConfigMap
+	assert.Nil(t, yaml.Unmarshal(docs[3], &configMap))
+	assert.Equal(t, "ConfigMap", configMap.Kind)
+	assert.Equal(t, "", configMap.Namespace)
+	assert.Equal(t, map[string]string{"setting": "value"}, configMap.Data)
+
+	var tls corev1.Secret
+	assert.Nil(t, yaml.Unmarshal(docs[4], &tls))
+	assert.Equal(t, "tls", tls.Name)
+	assert.Equal(t, corev1.SecretTypeTLS, tls.Type)
+	assert.Equal(t, map[string][]byte{"tls.crt": crt, "tls.key": key}, tls.Data)
+
+	dir, err := ioutil.TempDir("", "vault-handler-render")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	r = NewRender(d, manifest, "", K8sYAMLFormat, dir, nil)
+	assert.Nil(t, r.Prepare())
+	assert.Nil(t, r.Execute(false))
+	for _, name := range []string{"a.app.yaml", "b.app.yaml", "config.yaml", "tls.yaml"} {
+		assert.True(t, FileExists(path.Join(dir, name)))
+	}
+
+	r = NewRender(d, manifest, "", "sealed", "", &out)
+	assert.NotNil(t, r.Prepare())
+}
+
+func TestRenderInvalidSecretType(t *testing.T) {
+	manifest := &Manifest{Secrets: map[string]Secrets{"app": {Path: "kv/app", Type: "kubernetes.io/tls"}}}
+	d := NewDownload(nil, "")
+	d.Files = []*File{NewFile("app", "kubernetes.io/tls", &SecretData{Name: "tls.crt"}, []byte("crt"))}
+
+	err := NewRender(d, manifest, "", K8sYAMLFormat, "", nil).Prepare()
+	assert.NotNil(t, err)
+	assert.Equal(t, "group 'app': type 'kubernetes.io/tls' requires key 'tls.key', add it to data", err.Error())
+}
@@ -0,0 +1,148 @@
+package vaulthandler
+
+import (
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+)
+
+// secretTypeKeys required keys per built-in Kubernetes secret type. When more than one key is listed
+// for a type, in a single entry, at least one of them is required.
+var secretTypeKeys = map[corev1.SecretType][][]string{
+	corev1.SecretTypeTLS:              {{corev1.TLSCertKey}, {corev1.TLSPrivateKeyKey}},
+	corev1.SecretTypeDockerConfigJson: {{corev1.DockerConfigJsonKey}},
+	corev1.SecretTypeDockercfg:        {{corev1.DockerConfigKey}},
+	corev1.SecretTypeBasicAuth:        {{corev1.BasicAuthUsernameKey, corev1.BasicAuthPasswordKey}},
+	corev1.SecretTypeSSHAuth:          {{corev1.SSHAuthPrivateKey}},
+}
+
+// missingSecretTypeKeys returns messages for required keys of secret type not present in names.
+func missingSecretTypeKeys(secretType string, names []string) []string {
+	var missing []string
+
+	present := make(map[string]bool)
+	for _, name := range names {
+		present[name] = true
+	}
+	for _, keys := range secretTypeKeys[corev1.SecretType(secretType)] {
+		found := false
+		for _, key := range keys {
+			found = found || present[key]
+		}
+		if found {
+			continue
+		}
+		if len(keys) == 1 {
+			missing = append(missing, fmt.Sprintf("type '%s' requires key '%s', add it to data",
+				secretType, keys[0]))
+		} else {
+			missing = append(missing, fmt.Sprintf("type '%s' requires at least one of keys '%s', add it to data",
+				secretType, strings.Join(keys, "', '")))
+		}
+	}
+	return missing
+}
+
+// validateSecretTypeData check required keys and payload formats of built-in secret types: PEM for
+// TLS and SSH keys, and JSON for docker configuration.
+func validateSecretTypeData(secretType string, data map[string][]byte) error {
+	var names []string
+
+	for name := range data {
+		names = append(names, name)
+	}
+	if missing := missingSecretTypeKeys(secretType, names); len(missing) > 0 {
+		return fmt.Errorf("%s", strings.Join(missing, "; "))
+	}
+
+	switch corev1.SecretType(secretType) {
+	case corev1.SecretTypeTLS:
+		if err := validatePEMCertificates(data[corev1.TLSCertKey]); err != nil {
+			return fmt.Errorf("key '%s' is not a PEM encoded certificate: %s", corev1.TLSCertKey, err)
+		}
+		if err := validatePEMPrivateKey(data[corev1.TLSPrivateKeyKey]); err != nil {
+			return fmt.Errorf("key '%s' is not a PEM encoded private key: %s", corev1.TLSPrivateKeyKey, err)
+		}
+	case corev1.SecretTypeSSHAuth:
+		if block, _ := pem.Decode(data[corev1.SSHAuthPrivateKey]); block == nil {
+			return fmt.Errorf("key '%s' is not a PEM encoded private key", corev1.SSHAuthPrivateKey)
+		}
+	case corev1.SecretTypeDockerConfigJson:
+		var config struct {
+			Auths map[string]map[string]interface{} `json:"auths"`
+		}
+		if err := json.Unmarshal(data[corev1.DockerConfigJsonKey], &config); err != nil {
+			return fmt.Errorf("key '%s' is not valid docker configuration JSON: %s",
+				corev1.DockerConfigJsonKey, err)
+		}
+		if config.Auths == nil {
+			return fmt.Errorf("key '%s' must have an 'auths' object", corev1.DockerConfigJsonKey)
+		}
+	case corev1.SecretTypeDockercfg:
+		var config map[string]map[string]interface{}
+		if err := json.Unmarshal(data[corev1.DockerConfigKey], &config); err != nil {
+			return fmt.Errorf("key '%s' is not valid docker configuration JSON: %s",
+				corev1.DockerConfigKey, err)
+		}
+	}
+	return nil
+}
+
+// validatePEMCertificates check payload contains only PEM certificates, at least one.
+func validatePEMCertificates(payload []byte) error {
+	_, err := parsePEMCertificates(payload)
+	return err
+}
+
+// parsePEMCertificates parse PEM certificates in payload, in order, failing on other blocks or when
+// no certificate is found.
+func parsePEMCertificates(payload []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+
+	for {
+		block, rest := pem.Decode(payload)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			return nil, fmt.Errorf("unexpected PEM block '%s'", block.Type)
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+		payload = rest
+	}
+	if len(certs) == 0 {
+		return nil, fmt.Errorf("no PEM certificate found")
+	}
+	return certs, nil
+}
+
+// validatePEMPrivateKey check payload is a PEM private key, in PKCS#1, PKCS#8 or EC format, or
+// encrypted.
+func validatePEMPrivateKey(payload []byte) error {
+	block, _ := pem.Decode(payload)
+	if block == nil {
+		return fmt.Errorf("no PEM block found")
+	}
+	// encrypted keys can't be parsed without passphrase
+	if isEncryptedPEMKey(payload) {
+		return nil
+	}
+	if _, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	if _, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return nil
+	}
+	return fmt.Errorf("unable to parse '%s' block as PKCS#1, PKCS#8 or EC private key", block.Type)
+}
@@ -0,0 +1,103 @@
+package vaulthandler
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	corev1 "k8s.io/api/core/v1"
+)
+
+// testIssuer certificate authority signing test certificates.
+type testIssuer struct {
+	cert *x509.Certificate // issuer certificate
+	key  *ecdsa.PrivateKey // issuer private key
+}
+
+// newTestIssuer parse PEM certificate and key, as created by testCertificate, into an issuer.
+func newTestIssuer(t *testing.T, crt, key []byte) *testIssuer {
+	block, _ := pem.Decode(crt)
+	cert, err := x509.ParseCertificate(block.Bytes)
+	assert.Nil(t, err)
+	block, _ = pem.Decode(key)
+	privateKey, err := x509.ParseECPrivateKey(block.Bytes)
+	assert.Nil(t, err)
+	return &testIssuer{cert: cert, key: privateKey}
+}
+
+// testCertificate PEM certificate and key, valid until informed time, signed by issuer. When issuer
+// is nil, certificate is self-signed and can act as a certificate authority.
+func testCertificate(t *testing.T, notAfter time.Time, issuer *testIssuer) ([]byte, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "ca"},
+		NotBefore:             notAfter.Add(-365 * 24 * time.Hour),
+		NotAfter:              notAfter,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+	}
+	parent, signer := template, key
+	if issuer != nil {
+		template = &x509.Certificate{
+			SerialNumber: big.NewInt(2),
+			Subject:      pkix.Name{CommonName: "leaf"},
+			NotBefore:    template.NotBefore,
+			NotAfter:     notAfter,
+		}
+		parent, signer = issuer.cert, issuer.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, signer)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+}
+
+func TestSecretTypeMissingKeys(t *testing.T) {
+	assert.Len(t, missingSecretTypeKeys("Opaque", nil), 0)
+	assert.Len(t, missingSecretTypeKeys("kubernetes.io/tls", []string{"tls.crt", "tls.key"}), 0)
+	assert.Equal(t, []string{"type 'kubernetes.io/tls' requires key 'tls.key', add it to data"},
+		missingSecretTypeKeys("kubernetes.io/tls", []string{"tls.crt"}))
+	assert.Len(t, missingSecretTypeKeys("kubernetes.io/basic-auth", []string{"password"}), 0)
+	assert.Len(t, missingSecretTypeKeys("kubernetes.io/basic-auth", []string{"token"}), 1)
+}
+
+func TestSecretTypeValidateData(t *testing.T) {
+	crt, key := testCertificate(t, time.Now().Add(time.Hour), nil)
+
+	assert.Nil(t, validateSecretTypeData("Opaque", map[string][]byte{"any": []byte("thing")}))
+	assert.Nil(t, validateSecretTypeData(string(corev1.SecretTypeTLS),
+		map[string][]byte{"tls.crt": append(crt, crt...), "tls.key": key}))
+	assert.Nil(t, validateSecretTypeData(string(corev1.SecretTypeTLS), map[string][]byte{
+		"tls.crt": crt,
+		"tls.key": readFile("../../test/mock/kube-secrets/ingress.tls.key.secret"),
+	}))
+	assert.Nil(t, validateSecretTypeData(string(corev1.SecretTypeDockerConfigJson),
+		map[string][]byte{".dockerconfigjson": []byte(`{"auths":{"registry":{"auth":"dXNlcjpwYXNz"}}}`)}))
+
+	for secretType, data := range map[corev1.SecretType]map[string][]byte{
+		corev1.SecretTypeTLS:              {"tls.crt": crt},
+		corev1.SecretTypeBasicAuth:        {"token": []byte("token")},
+		corev1.SecretTypeSSHAuth:          {"ssh-privatekey": []byte("key")},
+		corev1.SecretTypeDockerConfigJson: {".dockerconfigjson": []byte(`{"registry":{}}`)},
+		corev1.SecretTypeDockercfg:        {".dockercfg": []byte(`{`)},
+	} {
+		assert.NotNil(t, validateSecretTypeData(string(secretType), data), string(secretType))
+	}
+	assert.NotNil(t, validateSecretTypeData(string(corev1.SecretTypeTLS),
+		map[string][]byte{"tls.crt": key, "tls.key": key}))
+	assert.NotNil(t, validateSecretTypeData(string(corev1.SecretTypeTLS),
+		map[string][]byte{"tls.crt": crt, "tls.key": crt}))
+}
@@ -0,0 +1,166 @@
+package vaulthandler
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path"
+	"strings"
+	"text/template"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Templates renders manifest templates with downloaded secrets, writing results on output directory.
+// Template data is a map of group and secret name to payload, so "{{ .app.password }}", or
+// "{{ secret "app" "password" }}" for names that are not valid template identifiers.
+type Templates struct {
+	logger    *log.Entry  // logger
+	manifest  *Manifest   // manifest, with templates
+	outputDir string      // output directory
+	documents []*document // rendered templates
+}
+
+// templateFuncs helper functions available in templates, besides secret lookup.
+var templateFuncs = template.FuncMap{
+	"base64":       func(s string) string { return base64.StdEncoding.EncodeToString([]byte(s)) },
+	"base64Decode": base64Decode,
+	"indent":       indent,
+	"toJSON":       toJSON,
+	"trim":         strings.TrimSpace,
+	"pemBlocks":    pemBlocks,
+	"pemFirst":     pemFirst,
+}
+
+// base64Decode decode standard base64 string.
+func base64Decode(s string) (string, error) {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	return string(decoded), err
+}
+
+// indent every non-empty line by informed amount of spaces.
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	lines := strings.Split(s, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = pad + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// toJSON encode value as JSON, strings are quoted and escaped.
+func toJSON(v interface{}) (string, error) {
+	payload, err := json.Marshal(v)
+	return string(payload), err
+}
+
+// pemBlocks extract PEM blocks of informed type, like "CERTIFICATE", from payload.
+func pemBlocks(blockType, s string) (string, error) {
+	var out []byte
+
+	rest := []byte(s)
+	for {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type == blockType {
+			out = append(out, pem.EncodeToMemory(block)...)
+		}
+	}
+	if len(out) == 0 {
+		return "", fmt.Errorf("no PEM block of type '%s' is found", blockType)
+	}
+	return string(out), nil
+}
+
+// pemFirst extract the first PEM block of informed type, like the leaf of a certificate chain.
+func pemFirst(blockType, s string) (string, error) {
+	blocks, err := pemBlocks(blockType, s)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode([]byte(blocks))
+	return string(pem.EncodeToMemory(block)), nil
+}
+
+// data organize files payload by group and name.
+func (t *Templates) data(files []*File) map[string]map[string]string {
+	data := make(map[string]map[string]string)
+	for _, file := range files {
+		if _, found := data[file.Group]; !found {
+			data[file.Group] = make(map[string]string)
+		}
+		data[file.Group][file.Properties.Name] = string(file.Payload)
+	}
+	return data
+}
+
+// Prepare by parsing and executing every template against downloaded files, keeping results aside
+// for later write.
+func (t *Templates) Prepare(files []*File) error {
+	var payload []byte
+	var tmpl *template.Template
+	var err error
+
+	data := t.data(files)
+	funcs := template.FuncMap{
+		"secret": func(group, name string) (string, error) {
+			if payload, found := data[group][name]; found {
+				return payload, nil
+			}
+			return "", fmt.Errorf("secret '%s' is not found in group '%s'", name, group)
+		},
+	}
+
+	for _, item := range t.manifest.Templates {
+		source := t.manifest.TemplatePath(item)
+		logger := t.logger.WithFields(log.Fields{"source": source, "target": item.Target})
+
+		logger.Info("Rendering template")
+		if payload, err = ioutil.ReadFile(source); err != nil {
+			return err
+		}
+		tmpl = template.New(path.Base(source)).Option("missingkey=error").Funcs(templateFuncs).Funcs(funcs)
+		if tmpl, err = tmpl.Parse(string(payload)); err != nil {
+			return err
+		}
+		var buf bytes.Buffer
+		if err = tmpl.Execute(&buf, data); err != nil {
+			return err
+		}
+		t.documents = append(t.documents, &document{name: item.Target, payload: buf.Bytes()})
+	}
+	return nil
+}
+
+// Execute save rendered templates to file-system, or just print out in dry-run mode.
+func (t *Templates) Execute(dryRun bool) error {
+	for _, doc := range t.documents {
+		if dryRun {
+			t.logger.WithField("path", path.Join(t.outputDir, doc.name)).
+				Info("[DRY-RUN] Template is not written to file-system!")
+			continue
+		}
+		t.logger.WithFields(log.Fields{"name": doc.name, "bytes": len(doc.payload)}).
+			Info("Writing template")
+		if err := writeAtomic(t.outputDir, doc.name, doc.payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewTemplates creates a new Templates instance.
+func NewTemplates(manifest *Manifest, outputDir string) *Templates {
+	return &Templates{
+		logger:    log.WithFields(log.Fields{"type": "templates", "outputDir": outputDir}),
+		manifest:  manifest,
+		outputDir: outputDir,
+	}
+}
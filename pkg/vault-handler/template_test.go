@@ -0,0 +1,74 @@
+package vaulthandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vault-handler-templates")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tmpl := `user: {{ .db.username }}
+password: {{ secret "db" "password" | toJSON }}
+auth: {{ printf "%s:%s" .db.username .db.password | base64 }}
+ca: |
+{{ pemFirst "CERTIFICATE" .tls.chain | indent 2 }}`
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "database.yml.tmpl"), []byte(tmpl), 0600))
+
+	crt, _ := testCertificate(t, time.Now().Add(time.Hour), nil)
+	other, _ := testCertificate(t, time.Now().Add(time.Hour), nil)
+	files := []*File{
+		NewFile("db", "", &SecretData{Name: "username"}, []byte("user")),
+		NewFile("db", "", &SecretData{Name: "password"}, []byte(`p"ss`)),
+		NewFile("tls", "", &SecretData{Name: "chain"}, append(crt, other...)),
+	}
+	manifest := &Manifest{
+		File:      path.Join(dir, "manifest.yaml"),
+		Templates: []Template{{Source: "database.yml.tmpl", Target: "database.yml"}},
+	}
+
+	templates := NewTemplates(manifest, dir)
+	assert.Nil(t, templates.Prepare(files))
+	assert.Nil(t, templates.Execute(true))
+	assert.False(t, FileExists(path.Join(dir, "database.yml")))
+
+	assert.Nil(t, templates.Execute(false))
+	payload, err := ioutil.ReadFile(path.Join(dir, "database.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, "user: user\npassword: \"p\\\"ss\"\nauth: dXNlcjpwInNz\nca: |\n"+
+		indent(2, string(crt)), string(payload))
+
+	stat, err := os.Stat(path.Join(dir, "database.yml"))
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	for _, broken := range []string{
+		`{{ .db.token }}`,
+		`{{ secret "db" "token" }}`,
+		`{{ pemFirst "CERTIFICATE" .db.username }}`,
+		`{{ .db.username `,
+	} {
+		assert.Nil(t, ioutil.WriteFile(path.Join(dir, "database.yml.tmpl"), []byte(broken), 0600))
+		assert.NotNil(t, NewTemplates(manifest, dir).Prepare(files), broken)
+	}
+}
+
+func TestTemplatesFuncs(t *testing.T) {
+	decoded, err := base64Decode("dXNlcjpwYXNz\n")
+	assert.Nil(t, err)
+	assert.Equal(t, "user:pass", decoded)
+
+	assert.Equal(t, "  a\n\n  b", indent(2, "a\n\nb"))
+
+	crt, key := testCertificate(t, time.Now().Add(time.Hour), nil)
+	blocks, err := pemBlocks("EC PRIVATE KEY", string(append(crt, key...)))
+	assert.Nil(t, err)
+	assert.Equal(t, string(key), blocks)
+}
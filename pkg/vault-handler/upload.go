@@ -2,39 +2,51 @@ package vaulthandler
 
 import (
 	"fmt"
-	"os"
 
 	log "github.com/sirupsen/logrus"
 )
 
+const (
+	// ReplaceStrategy upload replaces all data on vault path with manifest keys.
+	ReplaceStrategy = "replace"
+	// MergeStrategy upload reads existing data on vault path and overlays manifest keys.
+	MergeStrategy = "merge"
+	// PatchStrategy upload patches manifest keys on vault path, only on kv-v2.
+	PatchStrategy = "patch"
+)
+
+// isUploadStrategy checks if informed strategy is supported.
+func isUploadStrategy(strategy string) bool {
+	switch strategy {
+	case ReplaceStrategy, MergeStrategy, PatchStrategy:
+		return true
+	default:
+		return false
+	}
+}
+
 // Upload data to Vault, by realizing a manifest against Vault.
 type Upload struct {
-	logger        *log.Entry                        // logger
-	vault         *Vault                            // vault api instance
-	inputDir      string                            // input directory path
-	uploadPerPath map[string]map[string]interface{} // map of vault-paths with another for secrets
+	logger          *log.Entry                        // logger
+	vault           *Vault                            // vault api instance
+	inputDir        string                            // input directory path
+	cas             bool                              // check-and-set mode
+	strategy        string                            // default upload strategy
+	uploadPerPath   map[string]map[string]interface{} // map of vault-paths with another for secrets
+	versions        map[string]int                    // current version per vault-path, on cas mode
+	strategyPerPath map[string]string                 // upload strategy per vault-path
 }
 
 // Prepare by reading secrets and letting them ready for next step of uploading.
-func (u *Upload) Prepare(logger *log.Entry, group, secretType, vaultPath string, data SecretData) error {
+func (u *Upload) Prepare(logger *log.Entry, group string, secrets Secrets, data SecretData) error {
 	var err error
 
 	logger.Info("Handling file")
-	file := NewFile(group, secretType, &data, []byte{})
+	file := NewFile(group, secrets.Type, &data, []byte{})
 
-	if data.FromEnv != "" {
-		logger.Infof("Reading payload from environment-variable '%s'", data.FromEnv)
-		payload := os.Getenv(data.FromEnv)
-		if payload == "" {
-			return fmt.Errorf("can't find environment variable '%s'", data.FromEnv)
-		}
-		file.Payload = []byte(payload)
-	} else {
-		logger.Infof("Reading payload from file-system.")
-		if err = file.Read(u.inputDir); err != nil {
-			logger.Error("error on reading file", err)
-			return err
-		}
+	if err = file.Load(u.inputDir); err != nil {
+		logger.Error("error on loading payload", err)
+		return err
 	}
 	if data.Zip {
 		if err = file.Zip(); err != nil {
@@ -44,15 +56,55 @@ func (u *Upload) Prepare(logger *log.Entry, group, secretType, vaultPath string,
 	}
 
 	// preparing map of data for the same vault path, dealing with payload as string
-	vaultPath = u.vault.composePath(data, vaultPath)
+	vaultPath := u.vault.composePath(data, secrets.Path)
+	if err = u.setStrategy(vaultPath, secrets.Strategy); err != nil {
+		return err
+	}
 	if _, exists := u.uploadPerPath[vaultPath]; !exists {
 		u.uploadPerPath[vaultPath] = make(map[string]interface{})
+		if err = u.readVersion(logger, vaultPath); err != nil {
+			return err
+		}
 	}
 	u.uploadPerPath[vaultPath][data.Name] = string(file.Payload)
 
 	return nil
 }
 
+// setStrategy for vault path, using group strategy or default. The same path can't be employed with
+// different strategies.
+func (u *Upload) setStrategy(vaultPath, strategy string) error {
+	if strategy == "" {
+		strategy = u.strategy
+	}
+	if strategy == "" {
+		strategy = ReplaceStrategy
+	}
+	if !isUploadStrategy(strategy) {
+		return fmt.Errorf("strategy '%s' is not supported, use replace, merge or patch", strategy)
+	}
+	if existing, found := u.strategyPerPath[vaultPath]; found && existing != strategy {
+		return fmt.Errorf("vault path '%s' is employed with different strategies ('%s' and '%s')",
+			vaultPath, existing, strategy)
+	}
+	u.strategyPerPath[vaultPath] = strategy
+	return nil
+}
+
+// readVersion on check-and-set mode, read current version of vault path to be used on write.
+func (u *Upload) readVersion(logger *log.Entry, vaultPath string) error {
+	var err error
+
+	if !u.cas {
+		return nil
+	}
+	if u.versions[vaultPath], err = u.vault.CurrentVersion(vaultPath); err != nil {
+		return err
+	}
+	logger.WithField("currentVersion", u.versions[vaultPath]).Info("Check-and-set version")
+	return nil
+}
+
 // Execute upload secrets to Vault per vault path.
 func (u *Upload) Execute(dryRun bool) error {
 	var err error
@@ -67,9 +119,13 @@ func (u *Upload) Execute(dryRun bool) error {
 	return nil
 }
 
-// vaultWrite data to vault path, or just print things out in dry-run mode.
+// vaultWrite data to vault path following the strategy, or just print things out in dry-run mode.
 func (u *Upload) vaultWrite(vaultPath string, data map[string]interface{}, dryRun bool) error {
-	logger := log.WithField("vaultPath", vaultPath)
+	var existing map[string]interface{}
+	var err error
+
+	strategy := u.strategyPerPath[vaultPath]
+	logger := log.WithFields(log.Fields{"vaultPath": vaultPath, "strategy": strategy})
 	logger.Info("Uploading secrets to Vault path")
 
 	for name, payload := range data {
@@ -77,20 +133,73 @@ func (u *Upload) vaultWrite(vaultPath string, data map[string]interface{}, dryRu
 		logger.Info("Uploading key")
 		logger.Tracef("Payload: '%s'", payload)
 	}
+	if dryRun || strategy == MergeStrategy {
+		if existing, err = u.vault.ReadData(vaultPath); err != nil {
+			return err
+		}
+	}
 	if dryRun {
+		u.foreignKeys(logger, strategy, existing, data)
 		logger.Infof("[DRY-RUN] File is not uploaded to Vault!")
 		return nil
 	}
 
+	version := u.versions[vaultPath]
+	switch strategy {
+	case PatchStrategy:
+		if u.cas {
+			logger.WithField("version", version).Info("Using check-and-set")
+			return u.vault.PatchCAS(vaultPath, data, version)
+		}
+		return u.vault.Patch(vaultPath, data)
+	case MergeStrategy:
+		data = mergeData(existing, data)
+	}
+	if u.cas {
+		logger.WithField("version", version).Info("Using check-and-set")
+		return u.vault.WriteCAS(vaultPath, data, version)
+	}
+
 	return u.vault.Write(vaultPath, data)
 }
 
+// foreignKeys report keys found on vault path which are not part of the manifest, and are either kept
+// or dropped depending on the strategy.
+func (u *Upload) foreignKeys(logger *log.Entry, strategy string, existing, data map[string]interface{}) {
+	for name := range existing {
+		if _, found := data[name]; found {
+			continue
+		}
+		if strategy == ReplaceStrategy {
+			logger.WithField("foreignKey", name).Warn("[DRY-RUN] Foreign key would be dropped!")
+		} else {
+			logger.WithField("foreignKey", name).Info("[DRY-RUN] Foreign key would be kept")
+		}
+	}
+}
+
+// mergeData overlay data on top of existing, returning a new map.
+func mergeData(existing, data map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{})
+	for name, payload := range existing {
+		merged[name] = payload
+	}
+	for name, payload := range data {
+		merged[name] = payload
+	}
+	return merged
+}
+
 // NewUpload creates a new instance of Upload.
-func NewUpload(vault *Vault, inputDir string) *Upload {
+func NewUpload(vault *Vault, inputDir string, cas bool, strategy string) *Upload {
 	return &Upload{
-		logger:        log.WithField("type", "upload"),
-		vault:         vault,
-		inputDir:      inputDir,
-		uploadPerPath: make(map[string]map[string]interface{}),
+		logger:          log.WithField("type", "upload"),
+		vault:           vault,
+		inputDir:        inputDir,
+		cas:             cas,
+		strategy:        strategy,
+		uploadPerPath:   make(map[string]map[string]interface{}),
+		versions:        make(map[string]int),
+		strategyPerPath: make(map[string]string),
 	}
 }
@@ -0,0 +1,60 @@
+package vaulthandler
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadStrategies(t *testing.T) {
+	m, v := newMockKV(t)
+	defer m.server.Close()
+
+	dir, err := ioutil.TempDir("", "vault-handler-upload")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(path.Join(dir, "group.key.txt"), []byte("manifest"), 0600)
+	assert.Nil(t, err)
+
+	data := SecretData{Name: "key", Extension: "txt"}
+	logger := log.WithField("test", "upload")
+
+	for _, strategy := range []string{ReplaceStrategy, MergeStrategy, PatchStrategy} {
+		m.secrets["app"] = []map[string]interface{}{{"foreign": "foreign", "key": "old"}}
+
+		u := NewUpload(v, dir, true, strategy)
+		err = u.Prepare(logger, "group", Secrets{Path: "kv/app"}, data)
+		assert.Nil(t, err)
+
+		// dry-run does not write
+		err = u.Execute(true)
+		assert.Nil(t, err)
+		assert.Len(t, m.secrets["app"], 1)
+
+		err = u.Execute(false)
+		assert.Nil(t, err)
+		assert.Len(t, m.secrets["app"], 2)
+
+		latest := m.secrets["app"][1]
+		assert.Equal(t, "manifest", latest["key"])
+		if strategy == ReplaceStrategy {
+			assert.NotContains(t, latest, "foreign")
+		} else {
+			assert.Equal(t, "foreign", latest["foreign"])
+		}
+	}
+}
+
+func TestUploadSetStrategy(t *testing.T) {
+	u := NewUpload(nil, "", false, "")
+
+	assert.Nil(t, u.setStrategy("kv/app", ""))
+	assert.Equal(t, ReplaceStrategy, u.strategyPerPath["kv/app"])
+
+	assert.NotNil(t, u.setStrategy("kv/app", MergeStrategy))
+	assert.NotNil(t, u.setStrategy("kv/other", "unknown"))
+}
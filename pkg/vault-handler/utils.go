@@ -1,8 +1,11 @@
 package vaulthandler
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
+	"path"
+	"strings"
 
 	log "github.com/sirupsen/logrus"
 )
@@ -32,6 +35,25 @@ func readFile(path string) []byte {
 	return fileBytes
 }
 
+// readCredentialFile read a credential from file, refusing world-readable files. Payload is trimmed.
+func readCredentialFile(path string) (string, error) {
+	var stat os.FileInfo
+	var payload []byte
+	var err error
+
+	if stat, err = os.Stat(path); err != nil {
+		return "", err
+	}
+	if stat.Mode().Perm()&0004 != 0 {
+		return "", fmt.Errorf("credential file '%s' is world-readable (%s), refusing to use it",
+			path, stat.Mode().Perm())
+	}
+	if payload, err = ioutil.ReadFile(path); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(payload)), nil
+}
+
 // isDir Check if informed path is a directory, boolean return.
 func isDir(dirPath string) bool {
 	stat, err := os.Stat(dirPath)
@@ -40,3 +62,31 @@ func isDir(dirPath string) bool {
 	}
 	return stat.IsDir()
 }
+
+// writeAtomic write payload on a temporary file in the same directory, and then rename it, so readers
+// never observe a partially written file. Empty directory means current directory.
+func writeAtomic(dir, name string, payload []byte) error {
+	var tmp *os.File
+	var err error
+
+	if dir == "" {
+		dir = "."
+	}
+	if tmp, err = ioutil.TempFile(dir, fmt.Sprintf(".%s.", name)); err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(payload); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path.Join(dir, name))
+}
@@ -1,6 +1,8 @@
 package vaulthandler
 
 import (
+	"io/ioutil"
+	"os"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -26,3 +28,21 @@ func TestUtilsIsDir(t *testing.T) {
 	found = isDir("../../should/not/exist")
 	assert.False(t, found)
 }
+
+func TestUtilsReadCredentialFile(t *testing.T) {
+	f, err := ioutil.TempFile("", "vault-handler-credential")
+	assert.Nil(t, err)
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString("credential\n")
+	assert.Nil(t, err)
+
+	assert.Nil(t, os.Chmod(f.Name(), 0644))
+	_, err = readCredentialFile(f.Name())
+	assert.NotNil(t, err)
+
+	assert.Nil(t, os.Chmod(f.Name(), 0600))
+	credential, err := readCredentialFile(f.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, "credential", credential)
+}
@@ -1,9 +1,13 @@
 package vaulthandler
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"net/http"
 	"path"
+	"strconv"
 	"strings"
 
 	vaultapi "github.com/hashicorp/vault/api"
@@ -12,33 +16,237 @@ import (
 
 // Vault represent Vault server and the actions it can receive.
 type Vault struct {
-	logger *log.Entry       // logger
-	client *vaultapi.Client // vault api client
-	token  string           // user token, or obtained with AppRole
+	logger  *log.Entry          // logger
+	client  *vaultapi.Client    // vault api client
+	token   string              // user token, or obtained via authentication method
+	auth    *vaultapi.Secret    // authentication secret, when token is obtained via login
+	renewer *vaultapi.Renewer   // background token renewer
+	mounts  map[string]*kvMount // secrets engine mounts cache, mount path as key
 }
 
 // AppRoleAuth execute approle authentication.
 func (v *Vault) AppRoleAuth(roleID, secretID string) error {
+	v.logger.Info("Starting AppRole authentication")
+	authData := map[string]interface{}{"role_id": roleID, "secret_id": secretID}
+	if err := v.login("auth/approle/login", authData); err != nil {
+		return err
+	}
+	v.logger.Info("Obtained a token via AppRole.")
+	return nil
+}
+
+// UnwrapSecretID unwrap a response-wrapped AppRole secret-id, making sure the wrapping token was
+// created for the secret-id of informed role. A wrapping token that can't be found was already
+// consumed or is expired, which may indicate the secret-id was intercepted.
+func (v *Vault) UnwrapSecretID(wrappingToken, roleName string) (string, error) {
 	var secret *vaultapi.Secret
+	var creationPath string
+	var secretID string
 	var err error
 
-	v.logger.Info("Starting AppRole authentication")
-	authData := map[string]interface{}{"role_id": roleID, "secret_id": secretID}
-	if secret, err = v.client.Logical().Write("auth/approle/login", authData); err != nil {
+	expectedPath := path.Join("auth", "approle", "role", roleName, "secret-id")
+	logger := v.logger.WithField("expectedPath", expectedPath)
+
+	logger.Info("Looking up wrapping token")
+	lookupData := map[string]interface{}{"token": wrappingToken}
+	if secret, err = v.client.Logical().Write("sys/wrapping/lookup", lookupData); err != nil {
+		return "", v.wrappingError(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("no wrapping token information is returned from vault")
+	}
+	if creationPath, _ = secret.Data["creation_path"].(string); creationPath != expectedPath {
+		return "", fmt.Errorf("wrapping token creation path '%s' does not match '%s'",
+			creationPath, expectedPath)
+	}
+
+	logger.Info("Unwrapping secret-id")
+	v.client.SetToken(wrappingToken)
+	secret, err = v.client.Logical().Unwrap(wrappingToken)
+	v.client.ClearToken()
+	if err != nil {
+		return "", v.wrappingError(err)
+	}
+	if secret == nil || secret.Data == nil {
+		return "", errors.New("no data is returned from vault on unwrapping secret-id")
+	}
+	if secretID, _ = secret.Data["secret_id"].(string); secretID == "" {
+		return "", errors.New("unwrapped data does not contain a secret-id")
+	}
+
+	return secretID, nil
+}
+
+// wrappingError inspect errors on handling wrapping tokens, to warn loudly about consumed tokens.
+func (v *Vault) wrappingError(err error) error {
+	if !strings.Contains(err.Error(), "wrapping token is not valid or does not exist") {
 		return err
 	}
-	if secret.Auth == nil || secret.Auth.ClientToken == "" {
+	v.logger.Error("Wrapping token was already consumed or is expired, secret-id may be intercepted!")
+	return fmt.Errorf("wrapping token was already consumed or is expired, secret-id may be "+
+		"intercepted: '%s'", err)
+}
+
+// KubernetesAuth execute kubernetes authentication, using the service-account token found on
+// informed path, against the auth-method mounted on mount-path.
+func (v *Vault) KubernetesAuth(mountPath, role, tokenPath string) error {
+	v.logger.Info("Starting Kubernetes authentication")
+	return v.jwtLogin(mountPath, role, tokenPath)
+}
+
+// JWTAuth execute JWT/OIDC authentication, using the token found on informed path.
+func (v *Vault) JWTAuth(mountPath, role, tokenPath string) error {
+	v.logger.Info("Starting JWT authentication")
+	return v.jwtLogin(mountPath, role, tokenPath)
+}
+
+// CertAuth execute TLS certificate authentication, by login with a dedicated client configured with
+// informed client certificate and key. Role name is optional.
+func (v *Vault) CertAuth(mountPath, role, certPath, keyPath string) error {
+	var client *vaultapi.Client
+	var secret *vaultapi.Secret
+	var err error
+
+	logger := v.logger.WithFields(log.Fields{"mountPath": mountPath, "role": role, "cert": certPath})
+	logger.Info("Starting TLS certificate authentication")
+
+	cfg := vaultapi.DefaultConfig()
+	cfg.Address = v.client.Address()
+	if err = cfg.ConfigureTLS(&vaultapi.TLSConfig{ClientCert: certPath, ClientKey: keyPath}); err != nil {
+		return err
+	}
+	if client, err = vaultapi.NewClient(cfg); err != nil {
+		return err
+	}
+	client.ClearToken()
+
+	authData := map[string]interface{}{}
+	if role != "" {
+		authData["name"] = role
+	}
+	if secret, err = client.Logical().Write(path.Join("auth", mountPath, "login"), authData); err != nil {
+		return err
+	}
+	return v.storeToken(secret)
+}
+
+// jwtLogin read a JWT from file-system and login with role against informed mount-path.
+func (v *Vault) jwtLogin(mountPath, role, tokenPath string) error {
+	var jwt []byte
+	var err error
+
+	logger := v.logger.WithFields(log.Fields{"mountPath": mountPath, "role": role})
+	logger.WithField("tokenPath", tokenPath).Info("Reading JWT from file-system")
+
+	if jwt, err = ioutil.ReadFile(tokenPath); err != nil {
+		return err
+	}
+	authData := map[string]interface{}{"role": role, "jwt": strings.TrimSpace(string(jwt))}
+	if err = v.login(path.Join("auth", mountPath, "login"), authData); err != nil {
+		return err
+	}
+	logger.Info("Obtained a token via JWT.")
+	return nil
+}
+
+// login write authentication data against informed path, and store the client token returned.
+func (v *Vault) login(authPath string, authData map[string]interface{}) error {
+	var secret *vaultapi.Secret
+	var err error
+
+	v.logger.WithField("authPath", authPath).Info("Login against Vault")
+	if secret, err = v.client.Logical().Write(authPath, authData); err != nil {
+		return err
+	}
+	return v.storeToken(secret)
+}
+
+// storeToken from authentication secret, to be used on next API calls.
+func (v *Vault) storeToken(secret *vaultapi.Secret) error {
+	if secret == nil || secret.Auth == nil || secret.Auth.ClientToken == "" {
 		return errors.New("no authentication data is returned from vault")
 	}
 
-	v.logger.Info("Obtained a token via AppRole.")
+	v.logger.WithFields(log.Fields{
+		"leaseDuration": secret.Auth.LeaseDuration,
+		"renewable":     secret.Auth.Renewable,
+	}).Info("Obtained token lease")
+
 	// saving token for next API calls.
+	v.auth = secret
 	v.token = secret.Auth.ClientToken
 	v.setHeaders()
 
 	return nil
 }
 
+// StartRenewal of obtained token lease in the background, in order to keep the token valid for long
+// running operations. Tokens informed directly, or not renewable, are skipped.
+func (v *Vault) StartRenewal() error {
+	var err error
+
+	if v.auth == nil || !v.auth.Auth.Renewable {
+		v.logger.Info("Token is not renewable, skipping renewal")
+		return nil
+	}
+	if v.renewer != nil {
+		return nil
+	}
+	if v.renewer, err = v.client.NewRenewer(&vaultapi.RenewerInput{Secret: v.auth}); err != nil {
+		return err
+	}
+
+	go v.renewer.Renew()
+	go v.watchRenewal(v.renewer)
+	return nil
+}
+
+// watchRenewal log renewal events until renewer is done.
+func (v *Vault) watchRenewal(renewer *vaultapi.Renewer) {
+	for {
+		select {
+		case err := <-renewer.DoneCh():
+			if err != nil {
+				v.logger.Errorf("Token renewal is stopped: '%s'", err)
+			} else {
+				v.logger.Info("Token renewal is stopped")
+			}
+			return
+		case renewal := <-renewer.RenewCh():
+			logger := v.logger.WithField("renewedAt", renewal.RenewedAt)
+			if renewal.Secret != nil && renewal.Secret.Auth != nil {
+				logger = logger.WithField("leaseDuration", renewal.Secret.Auth.LeaseDuration)
+			}
+			logger.Info("Token lease renewed")
+		}
+	}
+}
+
+// StopRenewal stop background token renewal, when started.
+func (v *Vault) StopRenewal() {
+	if v.renewer == nil {
+		return
+	}
+	v.renewer.Stop()
+	v.renewer = nil
+}
+
+// Revoke token obtained via authentication method, tokens informed directly are never revoked.
+func (v *Vault) Revoke() error {
+	if v.auth == nil {
+		v.logger.Info("Token is not obtained via login, skipping revocation")
+		return nil
+	}
+
+	v.StopRenewal()
+	v.logger.Info("Revoking token")
+	if err := v.client.Auth().Token().RevokeSelf(""); err != nil {
+		return err
+	}
+	v.auth = nil
+	return nil
+}
+
 // TokenAuth execute token based authentication.
 func (v *Vault) TokenAuth(token string) {
 	v.token = token
@@ -46,41 +254,290 @@ func (v *Vault) TokenAuth(token string) {
 }
 
 // Read data from a given vault path and key name, and returning a slice of bytes with payload.
-func (v *Vault) Read(path, key string) ([]byte, error) {
-	var secret *vaultapi.Secret
+func (v *Vault) Read(vaultPath, key string) ([]byte, error) {
+	payload, _, err := v.ReadVersion(vaultPath, key, 0)
+	return payload, err
+}
+
+// ReadVersion read data from a given vault path and key name, on a specific version of the secret
+// (zero means latest), returning the payload and the version actually read. Versions are only
+// available on key-value version 2, where version zero is returned for version 1.
+func (v *Vault) ReadVersion(vaultPath, key string, version int) ([]byte, int, error) {
+	var data map[string]interface{}
+	var payload []byte
 	var err error
 
-	v.logger.WithFields(log.Fields{"path": path, "key": key}).
+	v.logger.WithFields(log.Fields{"path": vaultPath, "key": key, "version": version}).
 		Infof("Reading data from Vault path")
 
-	if secret, err = v.client.Logical().Read(path); err != nil {
-		return nil, err
+	if data, version, err = v.readData(vaultPath, version); err != nil {
+		return nil, 0, err
 	}
-	if secret == nil || secret.Data == nil || len(secret.Data) == 0 {
-		return nil, fmt.Errorf("no data found on path '%s'", path)
+	if len(data) == 0 {
+		return nil, 0, fmt.Errorf("no data found on path '%s'", vaultPath)
 	}
 
-	return v.extractKey(secret.Data, key)
+	payload, err = v.extractKey(data, key)
+	return payload, version, err
+}
+
+// ReadData read all keys stored on vault path, on latest version. Returns nil when the path does not
+// exist, or the latest version is deleted.
+func (v *Vault) ReadData(vaultPath string) (map[string]interface{}, error) {
+	data, _, err := v.readData(vaultPath, 0)
+	return data, err
+}
+
+// readData read secret data of vault path on a given version, where zero means latest, returning
+// data and version read.
+func (v *Vault) readData(vaultPath string, version int) (map[string]interface{}, int, error) {
+	var m *kvMount
+	var secret *vaultapi.Secret
+	var err error
+
+	if m, err = v.mount(vaultPath); err != nil {
+		return nil, 0, err
+	}
+	if version > 0 && !m.isV2() {
+		return nil, 0, fmt.Errorf("version '%d' is informed for path '%s', but versions are only "+
+			"available on key-value version 2", version, vaultPath)
+	}
+	apiPath := m.apiPath(vaultPath, "data")
+	logger := v.logger.WithFields(log.Fields{"path": vaultPath, "apiPath": apiPath})
+
+	if version > 0 {
+		params := map[string][]string{"version": {strconv.Itoa(version)}}
+		secret, err = v.client.Logical().ReadWithData(apiPath, params)
+	} else {
+		secret, err = v.client.Logical().Read(apiPath)
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return nil, 0, nil
+	}
+	if !m.isV2() {
+		return secret.Data, 0, nil
+	}
+
+	data, _ := secret.Data["data"].(map[string]interface{})
+	if data == nil {
+		logger.Warn("No data found, latest version may be deleted")
+		return nil, 0, nil
+	}
+	if version, err = metadataVersion(secret.Data["metadata"]); err != nil {
+		return nil, 0, err
+	}
+	logger.WithField("version", version).Info("Read secret version")
+	return data, version, nil
 }
 
 // Write data to a vault path. Wrapper around Logical Write function in Vault API.
-func (v *Vault) Write(path string, data map[string]interface{}) error {
+func (v *Vault) Write(vaultPath string, data map[string]interface{}) error {
+	return v.write(vaultPath, data, nil)
+}
+
+// WriteCAS write data to a vault path using check-and-set, where the write only succeeds when the
+// current version of the secret is the informed version. Version zero means the secret must not
+// exist yet. On conflict, the error contains both versions.
+func (v *Vault) WriteCAS(vaultPath string, data map[string]interface{}, version int) error {
+	err := v.write(vaultPath, data, map[string]interface{}{"cas": version})
+	return v.casConflict(vaultPath, version, err)
+}
+
+// casConflict inspect error to create a meaningful message on check-and-set conflicts.
+func (v *Vault) casConflict(vaultPath string, version int, err error) error {
+	var current int
+
+	if err == nil || !strings.Contains(err.Error(), "check-and-set parameter did not match") {
+		return err
+	}
+	if current, err = v.CurrentVersion(vaultPath); err != nil {
+		return err
+	}
+	return fmt.Errorf("check-and-set conflict on path '%s': expected version '%d', but current "+
+		"version is '%d', someone else wrote in between", vaultPath, version, current)
+}
+
+// CurrentVersion read the current version of a secret out of its metadata, zero when the secret does
+// not exist. Only available on key-value version 2.
+func (v *Vault) CurrentVersion(vaultPath string) (int, error) {
+	var m *kvMount
+	var secret *vaultapi.Secret
 	var err error
 
-	v.logger.WithField("path", path).Infof("Writing data to Vault path")
+	if m, err = v.mount(vaultPath); err != nil {
+		return 0, err
+	}
+	if !m.isV2() {
+		return 0, fmt.Errorf("can't read version of path '%s', versions are only available on "+
+			"key-value version 2", vaultPath)
+	}
+	apiPath := m.apiPath(vaultPath, "metadata")
+
+	v.logger.WithFields(log.Fields{"path": vaultPath, "apiPath": apiPath}).
+		Info("Reading secret metadata")
+	if secret, err = v.client.Logical().Read(apiPath); err != nil {
+		return 0, err
+	}
+	if secret == nil || secret.Data == nil {
+		return 0, nil
+	}
+	return toInt(secret.Data["current_version"])
+}
+
+// Patch data on vault path, where only informed keys are changed, using JSON merge-patch. Patch is
+// only available on key-value version 2.
+func (v *Vault) Patch(vaultPath string, data map[string]interface{}) error {
+	return v.patch(vaultPath, data, nil)
+}
+
+// PatchCAS patch data on vault path using check-and-set, like WriteCAS.
+func (v *Vault) PatchCAS(vaultPath string, data map[string]interface{}, version int) error {
+	err := v.patch(vaultPath, data, map[string]interface{}{"cas": version})
+	return v.casConflict(vaultPath, version, err)
+}
+
+// patch data on vault path, with optional options.
+func (v *Vault) patch(vaultPath string, data, options map[string]interface{}) error {
+	var m *kvMount
+	var resp *vaultapi.Response
+	var err error
+
+	if m, err = v.mount(vaultPath); err != nil {
+		return err
+	}
+	if !m.isV2() {
+		return fmt.Errorf("can't patch path '%s', patch is only available on key-value version 2",
+			vaultPath)
+	}
+	apiPath := m.apiPath(vaultPath, "data")
+
+	v.logger.WithFields(log.Fields{"path": vaultPath, "apiPath": apiPath}).
+		Infof("Patching data on Vault path")
+
+	body := map[string]interface{}{"data": data}
+	if options != nil {
+		body["options"] = options
+	}
+	req := v.client.NewRequest(http.MethodPatch, fmt.Sprintf("/v1/%s", apiPath))
+	// request headers are shared with the client, using a copy instead
+	headers := http.Header{}
+	for name, values := range req.Headers {
+		headers[name] = values
+	}
+	headers.Set("Content-Type", "application/merge-patch+json")
+	req.Headers = headers
+	if err = req.SetJSONBody(body); err != nil {
+		return err
+	}
+	resp, err = v.client.RawRequest(req)
+	if resp != nil {
+		defer resp.Body.Close()
+	}
+	return err
+}
+
+// write data to a vault path, adding options when using key-value version 2.
+func (v *Vault) write(vaultPath string, data, options map[string]interface{}) error {
+	var m *kvMount
+	var err error
+
+	if m, err = v.mount(vaultPath); err != nil {
+		return err
+	}
+	if options != nil && !m.isV2() {
+		return fmt.Errorf("write options are informed for path '%s', but are only available on "+
+			"key-value version 2", vaultPath)
+	}
+	apiPath := m.apiPath(vaultPath, "data")
+
+	v.logger.WithFields(log.Fields{"path": vaultPath, "apiPath": apiPath}).
+		Infof("Writing data to Vault path")
 
 	// wrapping up data for kv-v2
-	if strings.HasPrefix(path, "secret/data") {
+	if m.isV2() {
 		v.logger.Info("Using V2 API style, adding 'data' as key")
 		data = map[string]interface{}{"data": data}
+		if options != nil {
+			data["options"] = options
+		}
 	}
-	if _, err = v.client.Logical().Write(path, data); err != nil {
+	if _, err = v.client.Logical().Write(apiPath, data); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// mount inspect the secrets engine mount of informed path, in order to find out the key-value
+// version employed. Mounts are inspected only once, and kept in cache.
+func (v *Vault) mount(vaultPath string) (*kvMount, error) {
+	var found *kvMount
+	var secret *vaultapi.Secret
+	var err error
+
+	// looking for the longest mount path matching
+	for _, m := range v.mounts {
+		if m.hasPrefix(vaultPath) && (found == nil || len(m.path) > len(found.path)) {
+			found = m
+		}
+	}
+	if found != nil {
+		return found, nil
+	}
+
+	logger := v.logger.WithField("path", vaultPath)
+	logger.Info("Inspecting secrets engine mount")
+
+	mountPath := path.Join("sys/internal/ui/mounts", strings.Trim(vaultPath, "/"))
+	if secret, err = v.client.Logical().Read(mountPath); err != nil || secret == nil ||
+		secret.Data == nil {
+		found = guessMount(vaultPath)
+		logger.Warnf("Unable to inspect mount ('%v'), assuming '%s' on key-value version '%d'",
+			err, found.path, found.version)
+	} else {
+		found = &kvMount{version: 1}
+		found.path, _ = secret.Data["path"].(string)
+		if options, ok := secret.Data["options"].(map[string]interface{}); ok {
+			if version, _ := options["version"].(string); version == "2" {
+				found.version = 2
+			}
+		}
+		if found.path == "" {
+			found.path = guessMount(vaultPath).path
+		}
+	}
+
+	logger.WithFields(log.Fields{"mount": found.path, "version": found.version}).
+		Info("Using secrets engine mount")
+	v.mounts[found.path] = found
+	return found, nil
+}
+
+// metadataVersion extract version out of key-value version 2 metadata.
+func metadataVersion(metadata interface{}) (int, error) {
+	m, _ := metadata.(map[string]interface{})
+	if m == nil {
+		return 0, nil
+	}
+	return toInt(m["version"])
+}
+
+// toInt converts a numeric value, decoded from Vault's JSON responses, to integer.
+func toInt(value interface{}) (int, error) {
+	switch n := value.(type) {
+	case json.Number:
+		i, err := n.Int64()
+		return int(i), err
+	case float64:
+		return int(n), nil
+	default:
+		return 0, nil
+	}
+}
+
 // setHeaders prepare http request headers to inform token.
 func (v *Vault) setHeaders() {
 	headers := map[string][]string{"X-Vault-Token": {v.token}}
@@ -94,10 +551,6 @@ func (v *Vault) extractKey(payload map[string]interface{}, key string) ([]byte,
 	var data string
 	var exists bool
 
-	if _, exists = payload["data"]; exists {
-		v.logger.Info("Using V2 API style, extracting 'data' as key")
-		payload = payload["data"].(map[string]interface{})
-	}
 	if data, exists = payload[key].(string); !exists {
 		return nil, fmt.Errorf("cannot extract key '%s' from vault payload", key)
 	}
@@ -120,7 +573,10 @@ func (v *Vault) composePath(data SecretData, vaultPath string) string {
 func NewVault(addr string) (*Vault, error) {
 	var err error
 
-	vault := &Vault{logger: log.WithFields(log.Fields{"type": "Vault"})}
+	vault := &Vault{
+		logger: log.WithFields(log.Fields{"type": "Vault"}),
+		mounts: make(map[string]*kvMount),
+	}
 	vault.logger.WithField("addr", addr).Info("Instantiating Vault API client")
 
 	if vault.client, err = vaultapi.NewClient(&vaultapi.Config{Address: addr}); err != nil {
@@ -1,9 +1,15 @@
 package vaulthandler
 
 import (
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -14,6 +20,81 @@ const (
 
 var vault *Vault
 
+// mockKV in-memory key-value version 2 store, mounted on "kv/", served by httptest.
+type mockKV struct {
+	t        *testing.T
+	server   *httptest.Server
+	secrets  map[string][]map[string]interface{} // versions of data per path
+	requests []string                            // method and path of requests received
+}
+
+// serveHTTP handles mount inspection, data and metadata endpoints.
+func (m *mockKV) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Data    map[string]interface{} `json:"data"`
+		Options map[string]int         `json:"options"`
+	}
+
+	m.requests = append(m.requests, fmt.Sprintf("%s %s", r.Method, r.URL.Path))
+	switch {
+	case strings.HasPrefix(r.URL.Path, "/v1/sys/internal/ui/mounts/kv"):
+		_, _ = w.Write([]byte(`{"data": {"path": "kv/", "options": {"version": "2"}}}`))
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/metadata/"):
+		versions := m.secrets[strings.TrimPrefix(r.URL.Path, "/v1/kv/metadata/")]
+		if len(versions) == 0 {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = fmt.Fprintf(w, `{"data": {"current_version": %d}}`, len(versions))
+	case strings.HasPrefix(r.URL.Path, "/v1/kv/data/"):
+		secretPath := strings.TrimPrefix(r.URL.Path, "/v1/kv/data/")
+		versions := m.secrets[secretPath]
+		if r.Method == http.MethodGet {
+			if len(versions) == 0 {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+				"data":     versions[len(versions)-1],
+				"metadata": map[string]interface{}{"version": len(versions)},
+			}})
+			return
+		}
+
+		assert.Nil(m.t, json.NewDecoder(r.Body).Decode(&body))
+		if cas, found := body.Options["cas"]; found && cas != len(versions) {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"errors": ["check-and-set parameter did not match the current version"]}`))
+			return
+		}
+		data := body.Data
+		if r.Method == http.MethodPatch {
+			data = make(map[string]interface{})
+			for k, v := range versions[len(versions)-1] {
+				data[k] = v
+			}
+			for k, v := range body.Data {
+				data[k] = v
+			}
+		}
+		m.secrets[secretPath] = append(versions, data)
+		_, _ = fmt.Fprintf(w, `{"data": {"version": %d}}`, len(m.secrets[secretPath]))
+	default:
+		m.t.Errorf("unexpected request on path '%s'", r.URL.Path)
+	}
+}
+
+// newMockKV creates a running mockKV, and a Vault instance pointing to it.
+func newMockKV(t *testing.T) (*mockKV, *Vault) {
+	m := &mockKV{t: t, secrets: make(map[string][]map[string]interface{})}
+	m.server = httptest.NewServer(http.HandlerFunc(m.serveHTTP))
+
+	v, err := NewVault(m.server.URL)
+	assert.Nil(t, err)
+	v.TokenAuth("token")
+	return m, v
+}
+
 func TestVaultNewVault(t *testing.T) {
 	var err error
 
@@ -37,6 +118,282 @@ func TestVaultAppRoleAuth(t *testing.T) {
 	assert.Nil(t, err)
 }
 
+func TestVaultKubernetesAuth(t *testing.T) {
+	const jwt = "service-account-jwt"
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]string
+
+		assert.Equal(t, "/v1/auth/k8s/login", r.URL.Path)
+		assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "role", body["role"])
+		assert.Equal(t, jwt, body["jwt"])
+
+		_, _ = w.Write([]byte(`{"auth": {"client_token": "kubernetes-token"}}`))
+	}))
+	defer server.Close()
+
+	tokenFile, err := ioutil.TempFile("", "vault-handler-sa-token")
+	assert.Nil(t, err)
+	defer os.Remove(tokenFile.Name())
+	_, err = tokenFile.WriteString(jwt + "\n")
+	assert.Nil(t, err)
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	err = v.KubernetesAuth("k8s", "role", tokenFile.Name())
+	assert.Nil(t, err)
+	assert.Equal(t, "kubernetes-token", v.token)
+
+	err = v.KubernetesAuth("k8s", "role", "../../should/not/exist")
+	assert.NotNil(t, err)
+}
+
+func TestVaultUnwrapSecretID(t *testing.T) {
+	var unwrapped bool
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/wrapping/lookup":
+			_, _ = w.Write([]byte(`{"data": {"creation_path": "auth/approle/role/app/secret-id"}}`))
+		case "/v1/sys/wrapping/unwrap":
+			if unwrapped {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors": ["wrapping token is not valid or does not exist"]}`))
+				return
+			}
+			assert.Equal(t, "wrapping-token", r.Header.Get("X-Vault-Token"))
+			unwrapped = true
+			_, _ = w.Write([]byte(`{"data": {"secret_id": "secret-id"}}`))
+		default:
+			t.Errorf("unexpected request on path '%s'", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	_, err = v.UnwrapSecretID("wrapping-token", "other")
+	assert.NotNil(t, err)
+	assert.False(t, unwrapped)
+
+	secretID, err := v.UnwrapSecretID("wrapping-token", "app")
+	assert.Nil(t, err)
+	assert.Equal(t, "secret-id", secretID)
+
+	_, err = v.UnwrapSecretID("wrapping-token", "app")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "intercepted")
+}
+
+func TestVaultRenewalAndRevoke(t *testing.T) {
+	var revoked bool
+
+	auth := []byte(`{"auth": {"client_token": "approle-token", "lease_duration": 3600, "renewable": true}}`)
+	renewed := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/auth/approle/login":
+			_, _ = w.Write(auth)
+		case "/v1/auth/token/renew-self":
+			// renewer renews the token right away
+			assert.Equal(t, "approle-token", r.Header.Get("X-Vault-Token"))
+			_, _ = w.Write(auth)
+			select {
+			case renewed <- struct{}{}:
+			default:
+			}
+		case "/v1/auth/token/revoke-self":
+			assert.Equal(t, "approle-token", r.Header.Get("X-Vault-Token"))
+			revoked = true
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			t.Errorf("unexpected request on path '%s'", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	// tokens informed directly are not renewed or revoked
+	v.TokenAuth("token")
+	assert.Nil(t, v.StartRenewal())
+	assert.Nil(t, v.renewer)
+	assert.Nil(t, v.Revoke())
+	assert.False(t, revoked)
+
+	err = v.AppRoleAuth("role-id", "secret-id")
+	assert.Nil(t, err)
+
+	err = v.StartRenewal()
+	assert.Nil(t, err)
+	assert.NotNil(t, v.renewer)
+
+	select {
+	case <-renewed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("token is not renewed")
+	}
+
+	err = v.Revoke()
+	assert.Nil(t, err)
+	assert.True(t, revoked)
+	assert.Nil(t, v.renewer)
+}
+
+func TestVaultMountIntrospection(t *testing.T) {
+	var inspected int
+	var stored string
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/kv/app/db":
+			inspected++
+			_, _ = w.Write([]byte(`{"data": {"path": "kv/", "type": "kv", "options": {"version": "2"}}}`))
+		case "/v1/sys/internal/ui/mounts/v1/app":
+			inspected++
+			_, _ = w.Write([]byte(`{"data": {"path": "v1/", "type": "kv", "options": null}}`))
+		case "/v1/kv/data/app/db":
+			if r.Method == http.MethodGet {
+				_, _ = w.Write([]byte(`{"data": {"data": {"key": "` + stored + `"}}}`))
+				return
+			}
+			var body map[string]map[string]string
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			stored = body["data"]["key"]
+		case "/v1/v1/app":
+			_, _ = w.Write([]byte(`{"data": {"data": "v1-data-key"}}`))
+		default:
+			t.Errorf("unexpected request on path '%s'", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	err = v.Write("kv/app/db", map[string]interface{}{"key": "value"})
+	assert.Nil(t, err)
+	assert.Equal(t, "value", stored)
+
+	out, err := v.Read("kv/app/db", "key")
+	assert.Nil(t, err)
+	assert.Equal(t, "value", string(out))
+
+	// secret in version 1 legitimately having "data" as key
+	out, err = v.Read("v1/app", "data")
+	assert.Nil(t, err)
+	assert.Equal(t, "v1-data-key", string(out))
+
+	// mounts are inspected only once
+	assert.Equal(t, 2, inspected)
+}
+
+func TestVaultReadVersion(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/kv/app":
+			_, _ = w.Write([]byte(`{"data": {"path": "kv/", "options": {"version": "2"}}}`))
+		case "/v1/sys/internal/ui/mounts/v1/app":
+			_, _ = w.Write([]byte(`{"data": {"path": "v1/", "options": {"version": "1"}}}`))
+		case "/v1/kv/data/app":
+			version := r.URL.Query().Get("version")
+			if version == "" {
+				version = "5"
+			}
+			_, _ = w.Write([]byte(`{"data": {
+				"data": {"key": "value-` + version + `"}, "metadata": {"version": ` + version + `}
+			}}`))
+		default:
+			t.Errorf("unexpected request on path '%s'", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	out, version, err := v.ReadVersion("kv/app", "key", 3)
+	assert.Nil(t, err)
+	assert.Equal(t, "value-3", string(out))
+	assert.Equal(t, 3, version)
+
+	out, version, err = v.ReadVersion("kv/app", "key", 0)
+	assert.Nil(t, err)
+	assert.Equal(t, "value-5", string(out))
+	assert.Equal(t, 5, version)
+
+	_, _, err = v.ReadVersion("v1/app", "key", 3)
+	assert.NotNil(t, err)
+}
+
+func TestVaultWriteCAS(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/sys/internal/ui/mounts/kv/app":
+			_, _ = w.Write([]byte(`{"data": {"path": "kv/", "options": {"version": "2"}}}`))
+		case "/v1/kv/metadata/app":
+			_, _ = w.Write([]byte(`{"data": {"current_version": 4}}`))
+		case "/v1/kv/data/app":
+			var body struct {
+				Options map[string]int `json:"options"`
+			}
+			assert.Nil(t, json.NewDecoder(r.Body).Decode(&body))
+			if body.Options["cas"] != 4 {
+				w.WriteHeader(http.StatusBadRequest)
+				_, _ = w.Write([]byte(`{"errors": [
+					"check-and-set parameter did not match the current version"
+				]}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"data": {"version": 5}}`))
+		default:
+			t.Errorf("unexpected request on path '%s'", r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	v, err := NewVault(server.URL)
+	assert.Nil(t, err)
+
+	version, err := v.CurrentVersion("kv/app")
+	assert.Nil(t, err)
+	assert.Equal(t, 4, version)
+
+	data := map[string]interface{}{"key": "value"}
+	err = v.WriteCAS("kv/app", data, 4)
+	assert.Nil(t, err)
+
+	err = v.WriteCAS("kv/app", data, 3)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "kv/app")
+	assert.Contains(t, err.Error(), "'3'")
+	assert.Contains(t, err.Error(), "'4'")
+}
+
+func TestVaultPatch(t *testing.T) {
+	m, v := newMockKV(t)
+	defer m.server.Close()
+
+	m.secrets["app"] = []map[string]interface{}{{"foreign": "foreign", "key": "old"}}
+
+	err := v.Patch("kv/app", map[string]interface{}{"key": "new"})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]interface{}{"foreign": "foreign", "key": "new"}, m.secrets["app"][1])
+
+	err = v.PatchCAS("kv/app", map[string]interface{}{"key": "newer"}, 1)
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "'2'")
+
+	// patch is not available on key-value version 1
+	v.mounts["kv/"].version = 1
+	err = v.Patch("kv/app", map[string]interface{}{"key": "new"})
+	assert.NotNil(t, err)
+}
+
 func TestVaultWrite(t *testing.T) {
 	err := vault.Write("secret/data/foo/bar/baz", map[string]interface{}{"foo": foo})
 
@@ -0,0 +1,234 @@
+package vaulthandler
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// fetchFiles returns the files that should be present in output directory.
+type fetchFiles func() ([]*File, error)
+
+// signals supported to notify a process about changed secrets.
+var signals = map[string]syscall.Signal{
+	"HUP":  syscall.SIGHUP,
+	"INT":  syscall.SIGINT,
+	"QUIT": syscall.SIGQUIT,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+// parseSignal name, with or without "SIG" prefix.
+func parseSignal(name string) (syscall.Signal, error) {
+	signal, found := signals[strings.TrimPrefix(strings.ToUpper(name), "SIG")]
+	if !found {
+		return 0, fmt.Errorf("signal '%s' is not supported", name)
+	}
+	return signal, nil
+}
+
+// reloadTimeout default timeout of reload url request, when not informed.
+const reloadTimeout = 30 * time.Second
+
+// Reload notifies the application consuming secrets, after files are changed.
+type Reload struct {
+	PID     int           // process id to signal
+	Signal  string        // signal name
+	URL     string        // reload url, receives a POST request
+	Timeout time.Duration // reload url request timeout
+}
+
+// Execute reload by sending a signal to process, and/or calling reload url.
+func (r *Reload) Execute() error {
+	var process *os.Process
+	var signal syscall.Signal
+	var resp *http.Response
+	var err error
+
+	logger := log.WithField("type", "reload")
+	if r.PID > 0 {
+		if signal, err = parseSignal(r.Signal); err != nil {
+			return err
+		}
+		logger.Infof("Sending signal '%s' to process '%d'", signal, r.PID)
+		if process, err = os.FindProcess(r.PID); err != nil {
+			return err
+		}
+		if err = process.Signal(signal); err != nil {
+			return err
+		}
+	}
+	if r.URL != "" {
+		timeout := r.Timeout
+		if timeout <= 0 {
+			timeout = reloadTimeout
+		}
+		// a hung endpoint must not block the watch loop
+		client := &http.Client{Timeout: timeout}
+		logger.Infof("Calling reload URL '%s'", r.URL)
+		if resp, err = client.Post(r.URL, "text/plain", nil); err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 300 {
+			return fmt.Errorf("reload URL '%s' returned status '%s'", r.URL, resp.Status)
+		}
+	}
+	return nil
+}
+
+// Watch periodically fetch secrets, writing only the files that changed since last iteration.
+// Manifest templates are rendered again on every iteration, and written when changed as well.
+type Watch struct {
+	logger    *log.Entry        // logger
+	manifests []*Manifest       // manifests, templates are rendered from
+	outputDir string            // output directory
+	interval  time.Duration     // interval between iterations
+	jitter    time.Duration     // maximum random delay added to interval
+	dryRun    bool              // dry-run flag
+	reload    *Reload           // reload settings, optional
+	payloads  map[string][]byte // last written payload per file path
+}
+
+// Run fetch and write files on every interval, until stop channel is closed. Errors on the first
+// iteration are returned, later on they are only logged.
+func (w *Watch) Run(fetch fetchFiles, stop <-chan struct{}) error {
+	if err := w.Sync(fetch); err != nil {
+		return err
+	}
+	for {
+		delay := w.delay()
+		w.logger.Debugf("Next iteration in '%s'", delay)
+
+		select {
+		case <-stop:
+			w.logger.Info("Stopping watch")
+			return nil
+		case <-time.After(delay):
+			if err := w.Sync(fetch); err != nil {
+				w.logger.Errorf("On watching secrets: '%s'", err)
+			}
+		}
+	}
+}
+
+// Sync fetch files and render templates, writing the ones that changed, and triggering reload when
+// any file is written.
+func (w *Watch) Sync(fetch fetchFiles) error {
+	var files []*File
+	var changed int
+	var err error
+
+	if files, err = fetch(); err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		fullPath := file.FilePath(w.outputDir)
+		logger := w.logger.WithField("path", fullPath)
+
+		if !w.changed(fullPath, file.Payload) {
+			logger.Debug("File is not changed")
+			continue
+		}
+		changed++
+		if w.dryRun {
+			logger.Info("[DRY-RUN] File is not written to file-system!")
+			continue
+		}
+		logger.Info("File has changed, writing")
+		if err = file.Write(w.outputDir); err != nil {
+			return err
+		}
+		w.payloads[fullPath] = file.Payload
+	}
+
+	for _, manifest := range w.manifests {
+		t := NewTemplates(manifest, w.outputDir)
+		if err = t.Prepare(files); err != nil {
+			return err
+		}
+		for _, doc := range t.documents {
+			fullPath := path.Join(w.outputDir, doc.name)
+			logger := w.logger.WithField("path", fullPath)
+
+			if !w.changed(fullPath, doc.payload) {
+				logger.Debug("Template is not changed")
+				continue
+			}
+			changed++
+			if w.dryRun {
+				logger.Info("[DRY-RUN] Template is not written to file-system!")
+				continue
+			}
+			logger.Info("Template has changed, writing")
+			if err = writeAtomic(w.outputDir, doc.name, doc.payload); err != nil {
+				return err
+			}
+			w.payloads[fullPath] = doc.payload
+		}
+	}
+
+	if changed == 0 || w.reload == nil || w.dryRun {
+		return nil
+	}
+	w.logger.Infof("Files changed '%d', reloading", changed)
+	return w.reload.Execute()
+}
+
+// changed check payload against last written one, or against file-system on the first time.
+func (w *Watch) changed(fullPath string, payload []byte) bool {
+	previous, found := w.payloads[fullPath]
+	if !found {
+		existing, err := ioutil.ReadFile(fullPath)
+		if err != nil {
+			return true
+		}
+		w.payloads[fullPath] = existing
+		previous = existing
+	}
+	return !bytes.Equal(previous, payload)
+}
+
+// delay until next iteration, interval plus random jitter.
+func (w *Watch) delay() time.Duration {
+	return jitterDelay(w.interval, w.jitter)
+}
+
+// jitterDelay returns interval plus a random delay up to jitter.
+func jitterDelay(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// NewWatch creates a new Watch instance, reload is optional.
+func NewWatch(
+	manifests []*Manifest,
+	outputDir string,
+	interval, jitter time.Duration,
+	dryRun bool,
+	reload *Reload,
+) *Watch {
+	return &Watch{
+		logger:    log.WithField("type", "watch"),
+		manifests: manifests,
+		outputDir: outputDir,
+		interval:  interval,
+		jitter:    jitter,
+		dryRun:    dryRun,
+		reload:    reload,
+		payloads:  make(map[string][]byte),
+	}
+}
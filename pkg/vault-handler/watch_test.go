@@ -0,0 +1,137 @@
+package vaulthandler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchSync(t *testing.T) {
+	var reloads int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		reloads++
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vault-handler-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	payload := "first"
+	fetch := func() ([]*File, error) {
+		return []*File{
+			NewFile("group", "", &SecretData{Name: "key", Extension: "txt"}, []byte(payload)),
+		}, nil
+	}
+
+	w := NewWatch(nil, dir, time.Second, 0, false, &Reload{URL: server.URL})
+	filePath := NewFile("group", "", &SecretData{Name: "key", Extension: "txt"}, nil).FilePath(dir)
+
+	err = w.Sync(fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reloads)
+
+	// unchanged payload is not written again
+	err = w.Sync(fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, reloads)
+
+	payload = "second"
+	err = w.Sync(fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, reloads)
+
+	written, err := ioutil.ReadFile(filePath)
+	assert.Nil(t, err)
+	assert.Equal(t, "second", string(written))
+
+	// existing file on a new watch instance is not considered a change
+	w = NewWatch(nil, dir, time.Second, 0, false, &Reload{URL: server.URL})
+	err = w.Sync(fetch)
+	assert.Nil(t, err)
+	assert.Equal(t, 2, reloads)
+}
+
+func TestWatchSyncTemplates(t *testing.T) {
+	var reloads int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reloads++
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "vault-handler-watch")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	tmpl := []byte("password={{ .group.key }}")
+	assert.Nil(t, ioutil.WriteFile(path.Join(dir, "app.conf.tmpl"), tmpl, 0600))
+	manifest := &Manifest{
+		File:      path.Join(dir, "manifest.yaml"),
+		Templates: []Template{{Source: "app.conf.tmpl", Target: "app.conf"}},
+	}
+
+	payload := "first"
+	fetch := func() ([]*File, error) {
+		return []*File{NewFile("group", "", &SecretData{Name: "key"}, []byte(payload))}, nil
+	}
+
+	w := NewWatch([]*Manifest{manifest}, dir, time.Second, 0, false, &Reload{URL: server.URL})
+	assert.Nil(t, w.Sync(fetch))
+	assert.Nil(t, w.Sync(fetch))
+	assert.Equal(t, 1, reloads)
+
+	// rotated secret is rendered again
+	payload = "second"
+	assert.Nil(t, w.Sync(fetch))
+	assert.Equal(t, 2, reloads)
+
+	written, err := ioutil.ReadFile(path.Join(dir, "app.conf"))
+	assert.Nil(t, err)
+	assert.Equal(t, "password=second", string(written))
+
+	// missing template source fails the iteration
+	manifest.Templates[0].Source = "missing.tmpl"
+	assert.NotNil(t, w.Sync(fetch))
+}
+
+func TestWatchRun(t *testing.T) {
+	stop := make(chan struct{})
+	close(stop)
+
+	w := NewWatch(nil, "", time.Hour, time.Minute, true, nil)
+	err := w.Run(func() ([]*File, error) { return nil, nil }, stop)
+	assert.Nil(t, err)
+
+	delay := w.delay()
+	assert.True(t, delay >= time.Hour && delay < time.Hour+time.Minute)
+}
+
+func TestReloadTimeout(t *testing.T) {
+	done := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	}))
+	defer server.Close()
+	defer close(done)
+
+	r := &Reload{URL: server.URL, Timeout: 50 * time.Millisecond}
+	assert.NotNil(t, r.Execute())
+}
+
+func TestWatchParseSignal(t *testing.T) {
+	_, err := parseSignal("SIGHUP")
+	assert.Nil(t, err)
+	_, err = parseSignal("usr1")
+	assert.Nil(t, err)
+	_, err = parseSignal("unknown")
+	assert.NotNil(t, err)
+}
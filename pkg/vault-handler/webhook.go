@@ -0,0 +1,319 @@
+package vaulthandler
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// InjectManifestAnnotation pod annotation carrying an inline manifest.
+	InjectManifestAnnotation = "vault-handler/inject-manifest"
+	// InjectConfigMapAnnotation pod annotation naming a config-map with manifest, on pod namespace.
+	InjectConfigMapAnnotation = "vault-handler/inject-configmap"
+	// InjectRoleAnnotation pod annotation with Vault Kubernetes authentication role.
+	InjectRoleAnnotation = "vault-handler/inject-role"
+	// InjectedAnnotation marks pods already injected.
+	InjectedAnnotation = "vault-handler/injected"
+)
+
+const (
+	// injectContainerName name of init-container injected.
+	injectContainerName = "vault-handler"
+	// injectSecretsVolume name of in-memory volume shared with pod containers.
+	injectSecretsVolume = "vault-handler-secrets"
+	// injectManifestVolume name of volume carrying manifest file.
+	injectManifestVolume = "vault-handler-manifest"
+	// injectManifestDir directory manifest volume is mounted on init-container.
+	injectManifestDir = "/vault-handler/manifest"
+	// injectManifestFile manifest file name, and config-map key.
+	injectManifestFile = "manifest.yaml"
+	// serviceAccountDir directory service-account token is mounted on pod containers.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+)
+
+// patchOperation JSON-Patch operation.
+type patchOperation struct {
+	Op    string      `json:"op"`              // operation
+	Path  string      `json:"path"`            // json-pointer
+	Value interface{} `json:"value,omitempty"` // value to add
+}
+
+// Injector mutates pods annotated with a manifest, adding a init-container to download secrets into
+// a in-memory volume shared with all pod containers.
+type Injector struct {
+	image     string // vault-handler container image
+	vaultAddr string // vault address informed to init-container
+	mountPath string // path secrets volume is mounted on containers
+}
+
+// Mutate returns JSON-Patch operations to inject init-container and volumes, or nil when pod is not
+// annotated, or is already injected.
+func (i *Injector) Mutate(pod *corev1.Pod) ([]patchOperation, error) {
+	var patch []patchOperation
+
+	annotations := pod.GetAnnotations()
+	inline, hasInline := annotations[InjectManifestAnnotation]
+	configMap, hasConfigMap := annotations[InjectConfigMapAnnotation]
+	if (!hasInline && !hasConfigMap) || annotations[InjectedAnnotation] == "true" {
+		return nil, nil
+	}
+	if hasInline && hasConfigMap {
+		return nil, fmt.Errorf("annotations '%s' and '%s' can't be used together",
+			InjectManifestAnnotation, InjectConfigMapAnnotation)
+	}
+
+	manifestVolume := corev1.Volume{Name: injectManifestVolume}
+	if hasInline {
+		manifest, err := ParseManifest(InjectManifestAnnotation, []byte(inline))
+		if err == nil {
+			err = manifest.Validate()
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid manifest in annotation:\n%s", err)
+		}
+		// annotation is projected as a file, via downward-api
+		manifestVolume.DownwardAPI = &corev1.DownwardAPIVolumeSource{
+			Items: []corev1.DownwardAPIVolumeFile{{
+				Path: injectManifestFile,
+				FieldRef: &corev1.ObjectFieldSelector{
+					FieldPath: fmt.Sprintf("metadata.annotations['%s']", InjectManifestAnnotation),
+				},
+			}},
+		}
+	} else {
+		manifestVolume.ConfigMap = &corev1.ConfigMapVolumeSource{
+			LocalObjectReference: corev1.LocalObjectReference{Name: configMap},
+			Items:                []corev1.KeyToPath{{Key: injectManifestFile, Path: injectManifestFile}},
+		}
+	}
+	secretsVolume := corev1.Volume{
+		Name: injectSecretsVolume,
+		VolumeSource: corev1.VolumeSource{
+			EmptyDir: &corev1.EmptyDirVolumeSource{Medium: corev1.StorageMediumMemory},
+		},
+	}
+
+	patch = append(patch, appendPatch(
+		"/spec/volumes", len(pod.Spec.Volumes) == 0, secretsVolume, manifestVolume)...)
+	// init-container goes first, so secrets are present for other init-containers
+	if len(pod.Spec.InitContainers) == 0 {
+		patch = append(patch, patchOperation{
+			Op: "add", Path: "/spec/initContainers", Value: []corev1.Container{i.container(pod)},
+		})
+	} else {
+		patch = append(patch, patchOperation{
+			Op: "add", Path: "/spec/initContainers/0", Value: i.container(pod),
+		})
+	}
+
+	mount := corev1.VolumeMount{Name: injectSecretsVolume, MountPath: i.mountPath, ReadOnly: true}
+	for n, container := range pod.Spec.InitContainers {
+		// existing init-containers are shifted by one
+		patch = append(patch, appendPatch(fmt.Sprintf("/spec/initContainers/%d/volumeMounts", n+1),
+			len(container.VolumeMounts) == 0, mount)...)
+	}
+	for n, container := range pod.Spec.Containers {
+		patch = append(patch, appendPatch(fmt.Sprintf("/spec/containers/%d/volumeMounts", n),
+			len(container.VolumeMounts) == 0, mount)...)
+	}
+
+	patch = append(patch, patchOperation{
+		Op:    "add",
+		Path:  fmt.Sprintf("/metadata/annotations/%s", escapeJSONPointer(InjectedAnnotation)),
+		Value: "true",
+	})
+	return patch, nil
+}
+
+// container compose init-container downloading secrets described in manifest.
+func (i *Injector) container(pod *corev1.Pod) corev1.Container {
+	env := []corev1.EnvVar{{Name: "VAULT_HANDLER_VAULT_ADDR", Value: i.vaultAddr}}
+	if role := pod.GetAnnotations()[InjectRoleAnnotation]; role != "" {
+		env = append(env,
+			corev1.EnvVar{Name: "VAULT_HANDLER_VAULT_AUTH_METHOD", Value: KubernetesAuthMethod},
+			corev1.EnvVar{Name: "VAULT_HANDLER_VAULT_K8S_ROLE", Value: role},
+		)
+	}
+
+	mounts := []corev1.VolumeMount{
+		{Name: injectSecretsVolume, MountPath: i.mountPath},
+		{Name: injectManifestVolume, MountPath: injectManifestDir, ReadOnly: true},
+	}
+	if mount := serviceAccountMount(pod); mount != nil {
+		mounts = append(mounts, *mount)
+	}
+
+	return corev1.Container{
+		Name:  injectContainerName,
+		Image: i.image,
+		Args: []string{
+			"download",
+			"--output-dir", i.mountPath,
+			path.Join(injectManifestDir, injectManifestFile),
+		},
+		Env:          env,
+		VolumeMounts: mounts,
+	}
+}
+
+// serviceAccountMount returns the service-account token mount of pod containers, or nil. Webhooks
+// run after the service-account admission plugin, so the injected init-container must reuse the
+// same volume, otherwise Kubernetes authentication can't find the token.
+func serviceAccountMount(pod *corev1.Pod) *corev1.VolumeMount {
+	for _, container := range pod.Spec.Containers {
+		for _, mount := range container.VolumeMounts {
+			if mount.MountPath == serviceAccountDir {
+				return &corev1.VolumeMount{Name: mount.Name, MountPath: mount.MountPath, ReadOnly: true}
+			}
+		}
+	}
+	return nil
+}
+
+// appendPatch operations to append values on array, creating the array when empty.
+func appendPatch(arrayPath string, empty bool, values ...interface{}) []patchOperation {
+	if empty {
+		return []patchOperation{{Op: "add", Path: arrayPath, Value: values}}
+	}
+	var patch []patchOperation
+	for _, value := range values {
+		patch = append(patch, patchOperation{Op: "add", Path: arrayPath + "/-", Value: value})
+	}
+	return patch
+}
+
+// escapeJSONPointer escape a JSON-Pointer path segment.
+func escapeJSONPointer(segment string) string {
+	return strings.Replace(strings.Replace(segment, "~", "~0", -1), "/", "~1", -1)
+}
+
+// Webhook serves a mutating admission webhook over TLS, injecting pods with Injector.
+type Webhook struct {
+	logger   *log.Entry // logger
+	injector *Injector  // pod injector
+	listen   string     // listen address
+	certFile string     // tls certificate file
+	keyFile  string     // tls key file
+}
+
+// Review admission request, returning a response carrying the JSON-Patch for the pod. Pods that
+// can't be injected are denied.
+func (w *Webhook) Review(request *admissionv1beta1.AdmissionRequest) *admissionv1beta1.AdmissionResponse {
+	var pod corev1.Pod
+	var patch []patchOperation
+	var err error
+
+	response := &admissionv1beta1.AdmissionResponse{UID: request.UID, Allowed: true}
+	if request.Kind.Kind != "Pod" {
+		return response
+	}
+
+	logger := w.logger.WithFields(log.Fields{"namespace": request.Namespace, "uid": request.UID})
+	if err = json.Unmarshal(request.Object.Raw, &pod); err != nil {
+		return denyResponse(logger, response, err)
+	}
+	if patch, err = w.injector.Mutate(&pod); err != nil {
+		return denyResponse(logger, response, err)
+	}
+	if len(patch) == 0 {
+		return response
+	}
+
+	logger.WithField("name", pod.GetName()).Info("Injecting init-container")
+	if response.Patch, err = json.Marshal(patch); err != nil {
+		return denyResponse(logger, response, err)
+	}
+	patchType := admissionv1beta1.PatchTypeJSONPatch
+	response.PatchType = &patchType
+	return response
+}
+
+// denyResponse deny the admission request informing the error.
+func denyResponse(
+	logger *log.Entry, response *admissionv1beta1.AdmissionResponse, err error,
+) *admissionv1beta1.AdmissionResponse {
+	logger.Errorf("Denying admission: '%s'", err)
+	response.Allowed = false
+	response.Result = &metav1.Status{Message: err.Error()}
+	return response
+}
+
+// ServeHTTP decode AdmissionReview, and reply with the review response.
+func (w *Webhook) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	var review admissionv1beta1.AdmissionReview
+	var body []byte
+	var payload []byte
+	var err error
+
+	if req.Method != http.MethodPost {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if body, err = ioutil.ReadAll(req.Body); err != nil {
+		http.Error(rw, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err = json.Unmarshal(body, &review); err != nil || review.Request == nil {
+		http.Error(rw, "invalid admission review", http.StatusBadRequest)
+		return
+	}
+
+	review.Response = w.Review(review.Request)
+	review.Request = nil
+	if payload, err = json.Marshal(review); err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	rw.Header().Set("Content-Type", "application/json")
+	_, _ = rw.Write(payload)
+}
+
+// Run serve webhook on "/mutate" until stop channel is closed.
+func (w *Webhook) Run(stop <-chan struct{}) error {
+	mux := http.NewServeMux()
+	mux.Handle("/mutate", w)
+	server := &http.Server{Addr: w.listen, Handler: mux}
+
+	errs := make(chan error, 1)
+	go func() {
+		w.logger.WithField("listen", w.listen).Info("Serving webhook")
+		errs <- server.ListenAndServeTLS(w.certFile, w.keyFile)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-stop:
+		w.logger.Info("Stopping webhook")
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(ctx)
+	}
+}
+
+// NewInjector creates a new Injector instance.
+func NewInjector(image, vaultAddr, mountPath string) *Injector {
+	return &Injector{image: image, vaultAddr: vaultAddr, mountPath: mountPath}
+}
+
+// NewWebhook creates a new Webhook instance, listening on informed address with TLS.
+func NewWebhook(injector *Injector, listen, certFile, keyFile string) *Webhook {
+	return &Webhook{
+		logger:   log.WithField("type", "webhook"),
+		injector: injector,
+		listen:   listen,
+		certFile: certFile,
+		keyFile:  keyFile,
+	}
+}
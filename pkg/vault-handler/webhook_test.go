@@ -0,0 +1,175 @@
+package vaulthandler
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	admissionv1beta1 "k8s.io/api/admission/v1beta1"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const inlineManifest = `
+secrets:
+  app:
+    path: secret/app
+    data:
+      - name: password
+        extension: txt
+`
+
+// admissionReview fixture carrying pod.
+func admissionReview(t *testing.T, pod *corev1.Pod) []byte {
+	raw, err := json.Marshal(pod)
+	assert.Nil(t, err)
+	payload, err := json.Marshal(admissionv1beta1.AdmissionReview{
+		Request: &admissionv1beta1.AdmissionRequest{
+			UID:       "uid",
+			Kind:      metav1.GroupVersionKind{Version: "v1", Kind: "Pod"},
+			Namespace: "default",
+			Operation: admissionv1beta1.Create,
+			Object:    runtime.RawExtension{Raw: raw},
+		},
+	})
+	assert.Nil(t, err)
+	return payload
+}
+
+// postReview to webhook, returning review response.
+func postReview(t *testing.T, w *Webhook, payload []byte) *admissionv1beta1.AdmissionResponse {
+	var review admissionv1beta1.AdmissionReview
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader(payload)))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Nil(t, json.Unmarshal(rec.Body.Bytes(), &review))
+	assert.NotNil(t, review.Response)
+	return review.Response
+}
+
+func TestWebhookInjectInline(t *testing.T) {
+	var patch []patchOperation
+
+	w := NewWebhook(NewInjector("vault-handler:test", "https://vault:8200", "/secrets"), "", "", "")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			InjectManifestAnnotation: inlineManifest,
+			InjectRoleAnnotation:     "app",
+		}},
+		Spec: corev1.PodSpec{Containers: []corev1.Container{
+			{Name: "app", VolumeMounts: []corev1.VolumeMount{{Name: "data", MountPath: "/data"}}},
+			{Name: "sidecar"},
+		}},
+	}
+
+	response := postReview(t, w, admissionReview(t, pod))
+	assert.True(t, response.Allowed)
+	assert.Equal(t, "uid", string(response.UID))
+	assert.Equal(t, admissionv1beta1.PatchTypeJSONPatch, *response.PatchType)
+	assert.Nil(t, json.Unmarshal(response.Patch, &patch))
+
+	var paths []string
+	for _, op := range patch {
+		assert.Equal(t, "add", op.Op)
+		paths = append(paths, op.Path)
+	}
+	assert.Equal(t, []string{
+		"/spec/volumes",
+		"/spec/initContainers",
+		"/spec/containers/0/volumeMounts/-",
+		"/spec/containers/1/volumeMounts",
+		"/metadata/annotations/vault-handler~1injected",
+	}, paths)
+
+	container := w.injector.container(pod)
+	assert.Equal(t, "vault-handler:test", container.Image)
+	assert.Equal(t, []string{"download", "--output-dir", "/secrets", "/vault-handler/manifest/manifest.yaml"},
+		container.Args)
+	assert.Contains(t, container.Env, corev1.EnvVar{Name: "VAULT_HANDLER_VAULT_K8S_ROLE", Value: "app"})
+
+	// already injected pods are left alone
+	pod.Annotations[InjectedAnnotation] = "true"
+	response = postReview(t, w, admissionReview(t, pod))
+	assert.True(t, response.Allowed)
+	assert.Nil(t, response.Patch)
+}
+
+func TestWebhookInjectConfigMap(t *testing.T) {
+	i := NewInjector("vault-handler:test", "https://vault:8200", "/secrets")
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{InjectConfigMapAnnotation: "manifest"}},
+		Spec: corev1.PodSpec{
+			Volumes:        []corev1.Volume{{Name: "data"}},
+			InitContainers: []corev1.Container{{Name: "init"}},
+			Containers:     []corev1.Container{{Name: "app"}},
+		},
+	}
+
+	patch, err := i.Mutate(pod)
+	assert.Nil(t, err)
+	assert.Equal(t, "/spec/volumes/-", patch[0].Path)
+	assert.Equal(t, "/spec/volumes/-", patch[1].Path)
+	manifestVolume := patch[1].Value.(corev1.Volume)
+	assert.Equal(t, "manifest", manifestVolume.ConfigMap.Name)
+	assert.Equal(t, "/spec/initContainers/0", patch[2].Path)
+	assert.Equal(t, "/spec/initContainers/1/volumeMounts", patch[3].Path)
+	assert.Equal(t, "/spec/containers/0/volumeMounts", patch[4].Path)
+	assert.NotContains(t, i.container(pod).Env,
+		corev1.EnvVar{Name: "VAULT_HANDLER_VAULT_AUTH_METHOD", Value: KubernetesAuthMethod})
+
+	// pods without annotations are not mutated
+	patch, err = i.Mutate(&corev1.Pod{})
+	assert.Nil(t, err)
+	assert.Nil(t, patch)
+}
+
+func TestWebhookInjectServiceAccount(t *testing.T) {
+	i := NewInjector("vault-handler:test", "https://vault:8200", "/secrets")
+	token := corev1.VolumeMount{Name: "default-token-abcde", MountPath: serviceAccountDir, ReadOnly: true}
+	pod := &corev1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{
+			InjectManifestAnnotation: inlineManifest,
+			InjectRoleAnnotation:     "app",
+		}},
+		Spec: corev1.PodSpec{
+			Volumes: []corev1.Volume{{Name: "default-token-abcde"}},
+			Containers: []corev1.Container{
+				{Name: "app", VolumeMounts: []corev1.VolumeMount{token}},
+			},
+		},
+	}
+
+	patch, err := i.Mutate(pod)
+	assert.Nil(t, err)
+	assert.Equal(t, "/spec/initContainers", patch[2].Path)
+	container := patch[2].Value.([]corev1.Container)[0]
+	assert.Contains(t, container.VolumeMounts, token)
+
+	// without token volume, only secrets and manifest are mounted
+	assert.Len(t, i.container(&corev1.Pod{}).VolumeMounts, 2)
+}
+
+func TestWebhookDeny(t *testing.T) {
+	w := NewWebhook(NewInjector("vault-handler:test", "https://vault:8200", "/secrets"), "", "", "")
+
+	for _, annotations := range []map[string]string{
+		{InjectManifestAnnotation: "secrets: [invalid"},
+		{InjectManifestAnnotation: "secrets: {}"},
+		{InjectManifestAnnotation: inlineManifest, InjectConfigMapAnnotation: "manifest"},
+	} {
+		pod := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: annotations}}
+		response := postReview(t, w, admissionReview(t, pod))
+		assert.False(t, response.Allowed)
+		assert.NotEmpty(t, response.Result.Message)
+		assert.Nil(t, response.Patch)
+	}
+
+	rec := httptest.NewRecorder()
+	w.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/mutate", bytes.NewReader([]byte("{}"))))
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
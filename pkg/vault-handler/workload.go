@@ -0,0 +1,131 @@
+package vaulthandler
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+const (
+	// DeploymentKind workload kind.
+	DeploymentKind = "Deployment"
+	// StatefulSetKind workload kind.
+	StatefulSetKind = "StatefulSet"
+	// DaemonSetKind workload kind.
+	DaemonSetKind = "DaemonSet"
+	// ChecksumAnnotationPrefix prefix of pod-template annotations carrying group hash, followed by
+	// group name.
+	ChecksumAnnotationPrefix = "checksum.vault-handler/"
+)
+
+// workload kind and name of a kubernetes workload.
+type workload struct {
+	kind string // workload kind
+	name string // workload name
+}
+
+// String representation of workload.
+func (w workload) String() string {
+	return fmt.Sprintf("%s/%s", w.kind, w.name)
+}
+
+// workloadTarget workload on a namespace.
+type workloadTarget struct {
+	namespace string   // kubernetes namespace
+	workload  workload // workload kind and name
+}
+
+// String representation of workload target.
+func (w workloadTarget) String() string {
+	return fmt.Sprintf("%s/%s", w.namespace, w.workload)
+}
+
+// Workloads resolve informed names and label selector into workloads present in namespace.
+func (k *Kubernetes) Workloads(namespace string, workloads Workloads) ([]workload, error) {
+	var found []workload
+
+	seen := make(map[workload]bool)
+	add := func(w workload) {
+		if !seen[w] {
+			seen[w] = true
+			found = append(found, w)
+		}
+	}
+
+	for _, name := range workloads.Deployments {
+		add(workload{kind: DeploymentKind, name: name})
+	}
+	for _, name := range workloads.StatefulSets {
+		add(workload{kind: StatefulSetKind, name: name})
+	}
+	for _, name := range workloads.DaemonSets {
+		add(workload{kind: DaemonSetKind, name: name})
+	}
+	if workloads.Selector == "" {
+		return found, nil
+	}
+
+	apps := k.clientset.AppsV1()
+	opts := metav1.ListOptions{LabelSelector: workloads.Selector}
+
+	deployments, err := apps.Deployments(namespace).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments.Items {
+		add(workload{kind: DeploymentKind, name: deployment.Name})
+	}
+	statefulSets, err := apps.StatefulSets(namespace).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets.Items {
+		add(workload{kind: StatefulSetKind, name: statefulSet.Name})
+	}
+	daemonSets, err := apps.DaemonSets(namespace).List(opts)
+	if err != nil {
+		return nil, err
+	}
+	for _, daemonSet := range daemonSets.Items {
+		add(workload{kind: DaemonSetKind, name: daemonSet.Name})
+	}
+	return found, nil
+}
+
+// RestartWorkload patch workload pod-template with annotations, triggering a rollout. Returns false
+// when workload is not found.
+func (k *Kubernetes) RestartWorkload(
+	namespace string, w workload, annotations map[string]string,
+) (bool, error) {
+	var patch []byte
+	var err error
+
+	template := map[string]interface{}{"metadata": map[string]interface{}{"annotations": annotations}}
+	spec := map[string]interface{}{"template": template}
+	if patch, err = json.Marshal(map[string]interface{}{"spec": spec}); err != nil {
+		return false, err
+	}
+
+	k.logger.Infof("Restarting %s '%s/%s'", w.kind, namespace, w.name)
+	apps := k.clientset.AppsV1()
+	switch w.kind {
+	case DeploymentKind:
+		_, err = apps.Deployments(namespace).Patch(w.name, types.StrategicMergePatchType, patch)
+	case StatefulSetKind:
+		_, err = apps.StatefulSets(namespace).Patch(w.name, types.StrategicMergePatchType, patch)
+	case DaemonSetKind:
+		_, err = apps.DaemonSets(namespace).Patch(w.name, types.StrategicMergePatchType, patch)
+	default:
+		return false, fmt.Errorf("workload kind '%s' is not supported", w.kind)
+	}
+	if err != nil {
+		if errors.IsNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
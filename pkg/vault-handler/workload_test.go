@@ -0,0 +1,81 @@
+package vaulthandler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	appsv1 "k8s.io/api/apps/v1"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestKubernetesWorkloads(t *testing.T) {
+	web := map[string]string{"app": "web"}
+	k, _ := newFakeKubernetes(
+		&appsv1.Deployment{ObjectMeta: objectMeta(kubeNamespace, "web", web)},
+		&appsv1.StatefulSet{ObjectMeta: objectMeta(kubeNamespace, "db", web)},
+		&appsv1.DaemonSet{ObjectMeta: objectMeta(kubeNamespace, "agent", map[string]string{"app": "agent"})},
+	)
+
+	named := workload{kind: DeploymentKind, name: "named"}
+	deployment := workload{kind: DeploymentKind, name: "web"}
+	statefulSet := workload{kind: StatefulSetKind, name: "db"}
+
+	found, err := k.Workloads(kubeNamespace, Workloads{Deployments: []string{"named", "web"}})
+	assert.Nil(t, err)
+	assert.Equal(t, []workload{named, deployment}, found)
+
+	selected := Workloads{Deployments: []string{"web"}, Selector: "app=web"}
+	found, err = k.Workloads(kubeNamespace, selected)
+	assert.Nil(t, err)
+	assert.Equal(t, []workload{deployment, statefulSet}, found)
+
+	found, err = k.Workloads("other", Workloads{Selector: "app=web"})
+	assert.Nil(t, err)
+	assert.Len(t, found, 0)
+}
+
+func TestKubernetesRestartWorkload(t *testing.T) {
+	deployment := &appsv1.Deployment{
+		ObjectMeta: objectMeta(kubeNamespace, "web", nil),
+		Spec: appsv1.DeploymentSpec{Template: corev1.PodTemplateSpec{
+			ObjectMeta: metav1.ObjectMeta{Annotations: map[string]string{"foreign": "annotation"}},
+		}},
+	}
+	daemonSet := &appsv1.DaemonSet{ObjectMeta: objectMeta(kubeNamespace, "agent", nil)}
+	k, clientset := newFakeKubernetes(deployment, daemonSet)
+	checksum := ChecksumAnnotationPrefix + "app"
+	annotations := map[string]string{checksum: "hash"}
+	restart := func(kind, name string) (bool, error) {
+		return k.RestartWorkload(kubeNamespace, workload{kind: kind, name: name}, annotations)
+	}
+
+	restarted, err := restart(DeploymentKind, "web")
+	assert.Nil(t, err)
+	assert.True(t, restarted)
+
+	deployment, err = clientset.AppsV1().Deployments(kubeNamespace).Get("web", metav1.GetOptions{})
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]string{"foreign": "annotation", checksum: "hash"},
+		deployment.Spec.Template.Annotations)
+
+	restarted, err = restart(DaemonSetKind, "agent")
+	assert.Nil(t, err)
+	assert.True(t, restarted)
+
+	// fake clientset does not report missing objects on patch
+	notFound := func(k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.NewNotFound(schema.GroupResource{Resource: "statefulsets"}, "db")
+	}
+	clientset.PrependReactor("patch", "statefulsets", notFound)
+	restarted, err = restart(StatefulSetKind, "db")
+	assert.Nil(t, err)
+	assert.False(t, restarted)
+
+	_, err = restart("Job", "job")
+	assert.NotNil(t, err)
+}
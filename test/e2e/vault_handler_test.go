@@ -19,16 +19,18 @@ import (
 var manifestFiles = []string{"../mock/manifest-1.yaml", "../mock/manifest-2.yaml"}
 
 var config = &vh.Config{
-	VaultAddr:     "http://127.0.0.1:8200",
-	InputDir:      "../mock/input-dir",
-	OutputDir:     "/tmp",
-	DotEnv:        true,
-	VaultRoleID:   os.Getenv("VAULT_HANDLER_VAULT_ROLE_ID"),
-	VaultSecretID: os.Getenv("VAULT_HANDLER_VAULT_SECRET_ID"),
-	KubeConfig:    os.Getenv("KUBECONFIG"),
-	Context:       "",
-	Namespace:     "default",
-	InCluster:     false,
+	VaultAddr: "http://127.0.0.1:8200",
+	InputDir:  "../mock/input-dir",
+	OutputDir: "/tmp",
+	DotEnv:    true,
+	VaultAuthOptions: vh.AuthOptions{
+		"vault-role-id":   os.Getenv("VAULT_HANDLER_VAULT_ROLE_ID"),
+		"vault-secret-id": os.Getenv("VAULT_HANDLER_VAULT_SECRET_ID"),
+	},
+	KubeConfig: os.Getenv("KUBECONFIG"),
+	Context:    "",
+	Namespace:  "default",
+	InCluster:  false,
 }
 
 func TestVaultHandler(t *testing.T) {
@@ -182,11 +184,11 @@ func compareSecrets(t *testing.T) {
 	})
 
 	t.Logf("Integration kube-config: '%s'", config.KubeConfig)
-	kube, err := vh.NewKubernetes(config.KubeConfig, config.Context, config.Namespace, config.InCluster)
+	kube, err := vh.NewKubernetes(config.KubeConfig, config.Context, config.InCluster)
 	assert.Nil(t, err)
 
 	for group, data := range vaultSecrets {
-		kubeSecrets, err := kube.SecretRead(group)
+		kubeSecrets, err := kube.SecretRead(config.Namespace, group)
 		assert.Nil(t, err)
 
 		for name, payload := range data {